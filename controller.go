@@ -1,19 +1,37 @@
 package main
 
 import (
+	"encoding/json"
 	"example.com/tke-auth-controller/internal"
 	"example.com/tke-auth-controller/internal/CommonNameResolver"
+	"example.com/tke-auth-controller/internal/apis/tkeauth/v1alpha1"
+	tkeauthscheme "example.com/tke-auth-controller/internal/generated/clientset/versioned/scheme"
 	log "example.com/tke-auth-controller/log"
 	"fmt"
 	"github.com/pkg/errors"
 	tke "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/tke/v20180525"
+	"github.com/thoas/go-funk"
+	"io/ioutil"
 	v1 "k8s.io/api/core/v1"
 	v13 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	pkgruntime "k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	informersv1 "k8s.io/client-go/informers/core/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	listersv1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -29,31 +47,109 @@ import (
 */
 
 const (
-	reSyncWaitTimeout = time.Millisecond * 500
+	reSyncWaitTimeout   = time.Millisecond * 500
+	controllerAgentName = "tke-auth-controller"
+	// syncAllKey is key of workqueue to reconcile every source, used by periodic resync and changes of user group or policy
+	syncAllKey = "all"
+	// driftKeyPrefix is prefix of workqueue key to reconcile sources of drifted binding, followed by source keys joined by ","
+	driftKeyPrefix = "drift:"
+
+	// EventReasonSyncFailed is used for Event when binding of source object cannot be applied
+	EventReasonSyncFailed = "SyncFailed"
+	// EventReasonPolicyDenied is used for Event when binding of source object is denied by policy
+	EventReasonPolicyDenied = "PolicyDenied"
+	// EventReasonDriftReverted is used for Event when managed binding is changed by others, and the change is reverted
+	EventReasonDriftReverted = "DriftReverted"
 )
 
 type Controller struct {
 	kubeClient                 kubernetes.Interface
 	tkeAuthConfigMap           *internal.TKEAuthConfigMaps
+	tkeAuthBindings            *internal.TKEAuthBindings
+	tkeAuthSecrets             *internal.TKEAuthSecrets
 	tkeAuthClusterRoleBindings *internal.TKEAuthClusterRoleBindings
+	tkeAuthRoleBindings        *internal.TKEAuthRoleBindings
+	tkeAuthRoles               *internal.TKEAuthRoles
+
+	namespaceLister listersv1.NamespaceLister
+	namespaceSynced cache.InformerSynced
+
+	// queue has SourceKey of sources to reconcile, or syncAllKey to reconcile every source. processed by workers
+	queue workqueue.RateLimitingInterface
+	// syncLock prevents syncs of different keys from running concurrently
+	syncLock sync.Mutex
+	// syncedVersions is resourceVersion of sources applied by last successful sync, key is SourceKey
+	syncedVersions map[string]string
+	// fullySynced is set after first successful sync of every source. until then, every sync reconciles every source,
+	// since managed objects created by older version have no source annotation and cannot be kept untouched by scope.
+	fullySynced bool
+	// transitionTimer triggers sync at next notBefore or expiresAt of bindings and users
+	transitionTimer *time.Timer
+
+	syncErrors     map[string]error
+	syncErrorsLock sync.RWMutex
 
-	syncAllClusterRoleBindingTimer *time.Timer
+	// unwatchedSecrets is last known state of secrets with finalizer whose "tke-auth/binding" label is removed, key is SourceKey.
+	// they are out of label-filtered informer cache, so they are released by the state and their finalizer is removed
+	unwatchedSecrets     map[string]*v1.Secret
+	unwatchedSecretsLock sync.Mutex
 
 	clusterId string
 	tkeClient *tke.Client
 
 	commonNameResolver *CommonNameResolver.CommonNameResolver
+
+	// conflictPolicy decides which source is accepted when multiple sources claim same binding
+	conflictPolicy string
+	// requireNamespacePrefix rejects source if name of cluster-scoped object does not start with its namespace
+	requireNamespacePrefix bool
+	// policySource loads policy of ClusterRoles allowed to bind for each namespace
+	policySource *internal.PolicySource
+	// deletionGuard refuses sync deleting too many bindings at once
+	deletionGuard internal.DeletionGuard
+	// dryRun plans changes of every sync without writing anything to cluster, and reports the plan
+	dryRun bool
+	// planFile is path to write plan of last sync in dryRun mode, not written if empty
+	planFile string
+
+	recorder record.EventRecorder
 }
 
-func NewController(kubeClient kubernetes.Interface, tkeAuthCfg *internal.TKEAuthConfigMaps, tkeAuthCRB *internal.TKEAuthClusterRoleBindings, tkeClient *tke.Client, clusterId string, CNResolver *CommonNameResolver.CommonNameResolver) (*Controller, error) {
+func NewController(kubeClient kubernetes.Interface, tkeAuthCfg *internal.TKEAuthConfigMaps, tkeAuthBindings *internal.TKEAuthBindings, tkeAuthSecrets *internal.TKEAuthSecrets, tkeAuthCRB *internal.TKEAuthClusterRoleBindings, tkeAuthRB *internal.TKEAuthRoleBindings, tkeAuthRoles *internal.TKEAuthRoles, namespaceInformer informersv1.NamespaceInformer, tkeClient *tke.Client, clusterId string, CNResolver *CommonNameResolver.CommonNameResolver, conflictPolicy string, requireNamespacePrefix bool, policySource *internal.PolicySource, deletionGuard internal.DeletionGuard, dryRun bool, planFile string) (*Controller, error) {
+	if !funk.ContainsString(internal.ConflictPolicies, conflictPolicy) {
+		return nil, errors.Errorf("unknown conflictPolicy: %s, should be one of %s", conflictPolicy, internal.ConflictPolicies)
+	}
+
+	runtime.Must(tkeauthscheme.AddToScheme(scheme.Scheme))
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartStructuredLogging(0)
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: controllerAgentName})
+
 	ctl := &Controller{
-		kubeClient:                     kubeClient,
-		tkeAuthConfigMap:               tkeAuthCfg,
-		tkeAuthClusterRoleBindings:     tkeAuthCRB,
-		syncAllClusterRoleBindingTimer: nil,
-		tkeClient:                      tkeClient,
-		clusterId:                      clusterId,
-		commonNameResolver:             CNResolver,
+		kubeClient:                 kubeClient,
+		tkeAuthConfigMap:           tkeAuthCfg,
+		tkeAuthBindings:            tkeAuthBindings,
+		tkeAuthSecrets:             tkeAuthSecrets,
+		tkeAuthClusterRoleBindings: tkeAuthCRB,
+		tkeAuthRoleBindings:        tkeAuthRB,
+		tkeAuthRoles:               tkeAuthRoles,
+		namespaceLister:            namespaceInformer.Lister(),
+		namespaceSynced:            namespaceInformer.Informer().HasSynced,
+		queue:                      workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), controllerAgentName),
+		syncErrors:                 map[string]error{},
+		syncedVersions:             map[string]string{},
+		unwatchedSecrets:           map[string]*v1.Secret{},
+		tkeClient:                  tkeClient,
+		clusterId:                  clusterId,
+		commonNameResolver:         CNResolver,
+		conflictPolicy:             conflictPolicy,
+		requireNamespacePrefix:     requireNamespacePrefix,
+		policySource:               policySource,
+		deletionGuard:              deletionGuard,
+		dryRun:                     dryRun,
+		planFile:                   planFile,
+		recorder:                   recorder,
 	}
 
 	ctl.tkeAuthConfigMap.Informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -62,6 +158,28 @@ func NewController(kubeClient kubernetes.Interface, tkeAuthCfg *internal.TKEAuth
 		DeleteFunc: ctl.onConfigMapDeleted,
 	})
 
+	ctl.tkeAuthSecrets.Informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    ctl.onSecretAdded,
+		UpdateFunc: ctl.onSecretUpdated,
+		DeleteFunc: ctl.onSecretDeleted,
+	})
+
+	ctl.tkeAuthBindings.Informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    ctl.onTKEAuthBindingAdded,
+		UpdateFunc: ctl.onTKEAuthBindingUpdated,
+		DeleteFunc: ctl.onTKEAuthBindingDeleted,
+	})
+
+	ctl.tkeAuthClusterRoleBindings.Informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: ctl.onClusterRoleBindingUpdated,
+		DeleteFunc: ctl.onClusterRoleBindingDeleted,
+	})
+
+	ctl.tkeAuthRoleBindings.Informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: ctl.onRoleBindingUpdated,
+		DeleteFunc: ctl.onRoleBindingDeleted,
+	})
+
 	return ctl, nil
 }
 
@@ -72,11 +190,11 @@ func (ctl *Controller) onConfigMapAdded(new interface{}) {
 		return
 	}
 
-	if !v12.HasAnnotation(configMap.ObjectMeta, internal.AnnotationKeyTKEAuthConfigMap) {
+	if !ctl.isWatchedConfigMap(configMap) {
 		return
 	}
 
-	ctl.reserveReSyncTimer()
+	ctl.enqueueConfigMap(configMap)
 	klog.V(log.VerboseLevel).Infof("received configMap added event, name: %s\n", configMap.Name)
 }
 
@@ -93,8 +211,8 @@ func (ctl *Controller) onConfigMapUpdated(old, new interface{}) {
 		return
 	}
 
-	oldCfgMapIsManaged := v12.HasAnnotation(oldConfigMap.ObjectMeta, internal.AnnotationKeyTKEAuthConfigMap)
-	newCfgMapIsManaged := v12.HasAnnotation(newConfigMap.ObjectMeta, internal.AnnotationKeyTKEAuthConfigMap)
+	oldCfgMapIsManaged := ctl.isWatchedConfigMap(oldConfigMap)
+	newCfgMapIsManaged := ctl.isWatchedConfigMap(newConfigMap)
 
 	if !oldCfgMapIsManaged && !newCfgMapIsManaged {
 		return
@@ -102,92 +220,1176 @@ func (ctl *Controller) onConfigMapUpdated(old, new interface{}) {
 		klog.Warningf("configMap %s has annotation \"managed-by\" before, but is deleted.\n", newConfigMap.Name)
 	}
 
-	ctl.reserveReSyncTimer()
+	if internal.IsOnlyStatusAnnotationChanged(oldConfigMap, newConfigMap) { // updated by controller itself
+		return
+	}
+
+	if oldConfigMap.ResourceVersion == newConfigMap.ResourceVersion { // periodic resync reconciles every source
+		ctl.enqueueSync()
+	} else if v12.HasAnnotation(oldConfigMap.ObjectMeta, internal.AnnotationKeyTKEAuthConfigMap) {
+		ctl.enqueueSource(internal.ConfigMapReference(newConfigMap))
+	} else {
+		ctl.enqueueConfigMap(newConfigMap)
+	}
 	klog.V(log.VerboseLevel).Infof("received configMap changed event, name: %s\n", newConfigMap.Name)
 }
 
 func (ctl *Controller) onConfigMapDeleted(old interface{}) {
+	if tombstone, ok := old.(cache.DeletedFinalStateUnknown); ok {
+		old = tombstone.Obj
+	}
+
 	configMap, ok := old.(*v1.ConfigMap)
 	if !ok {
 		klog.Errorf("failed trying to cast old object to configMap, old: %s\n", old)
 		return
 	}
 
-	if !v12.HasAnnotation(configMap.ObjectMeta, internal.AnnotationKeyTKEAuthConfigMap) {
+	if !ctl.isWatchedConfigMap(configMap) {
 		return
 	}
 
-	ctl.reserveReSyncTimer()
+	ctl.enqueueConfigMap(configMap)
 	klog.V(log.VerboseLevel).Infof("received configMap deleted event, name: %s\n", configMap.Name)
 }
 
-func (ctl *Controller) reserveReSyncTimer() {
-	timer := &ctl.syncAllClusterRoleBindingTimer
-	if ctl.syncAllClusterRoleBindingTimer != nil {
-		(*timer).Reset(reSyncWaitTimeout)
+// enqueueConfigMap reconciles bindings of configMap only, or every source if configMap is user group or policy
+func (ctl *Controller) enqueueConfigMap(configMap *v1.ConfigMap) {
+	if v12.HasAnnotation(configMap.ObjectMeta, internal.AnnotationKeyTKEAuthConfigMap) || internal.HasFinalizer(configMap.ObjectMeta) {
+		ctl.enqueueSource(internal.ConfigMapReference(configMap))
+		return
+	}
+
+	ctl.enqueueSync()
+}
+
+// isWatchedConfigMap returns true if configMap is binding, user group or policy.
+// change of user group or policy re-syncs every binding, including bindings referencing the group.
+func (ctl *Controller) isWatchedConfigMap(configMap *v1.ConfigMap) bool {
+	return v12.HasAnnotation(configMap.ObjectMeta, internal.AnnotationKeyTKEAuthConfigMap) || v12.HasAnnotation(configMap.ObjectMeta, internal.AnnotationKeyUserGroup) || ctl.policySource.IsPolicyConfigMap(configMap)
+}
+
+func (ctl *Controller) onSecretAdded(new interface{}) {
+	secret, ok := new.(*v1.Secret)
+	if !ok {
+		klog.Errorf("failed trying to cast new object to secret, new: %s\n", new)
+		return
+	}
+
+	ctl.setUnwatchedSecret(internal.SourceKey(internal.SecretReference(secret)), nil) // label is added again
+
+	if !v12.HasAnnotation(secret.ObjectMeta, internal.AnnotationKeyTKEAuthConfigMap) {
+		return
+	}
+
+	ctl.enqueueSource(internal.SecretReference(secret))
+	klog.V(log.VerboseLevel).Infof("received secret added event, namespace: %s, name: %s\n", secret.Namespace, secret.Name)
+}
+
+func (ctl *Controller) onSecretUpdated(old, new interface{}) {
+	oldSecret, ok := old.(*v1.Secret)
+	if !ok {
+		klog.Errorf("failed trying to cast old object to secret, old: %s\n", old)
+		return
+	}
+
+	newSecret, ok := new.(*v1.Secret)
+	if !ok {
+		klog.Errorf("failed trying to cast new object to secret, new: %s\n", new)
+		return
+	}
+
+	if !v12.HasAnnotation(oldSecret.ObjectMeta, internal.AnnotationKeyTKEAuthConfigMap) && !v12.HasAnnotation(newSecret.ObjectMeta, internal.AnnotationKeyTKEAuthConfigMap) {
+		return
+	}
+
+	if internal.IsOnlySecretStatusAnnotationChanged(oldSecret, newSecret) { // updated by controller itself
+		return
+	}
+
+	if oldSecret.ResourceVersion == newSecret.ResourceVersion { // periodic resync reconciles every source
+		ctl.enqueueSync()
+	} else {
+		ctl.enqueueSource(internal.SecretReference(newSecret))
+	}
+	klog.V(log.VerboseLevel).Infof("received secret changed event, namespace: %s, name: %s\n", newSecret.Namespace, newSecret.Name)
+}
+
+func (ctl *Controller) onSecretDeleted(old interface{}) {
+	if tombstone, ok := old.(cache.DeletedFinalStateUnknown); ok {
+		old = tombstone.Obj
+	}
+
+	secret, ok := old.(*v1.Secret)
+	if !ok {
+		klog.Errorf("failed trying to cast old object to secret, old: %s\n", old)
+		return
+	}
+
+	// deleted secret is removed from cache after finalizer is removed, so secret with finalizer is still alive and its label is removed
+	if internal.HasFinalizer(secret.ObjectMeta) {
+		klog.Infof("label %s of secret %s/%s is removed, releasing the secret\n", internal.LabelKeyTKEAuthSecret, secret.Namespace, secret.Name)
+		ctl.setUnwatchedSecret(internal.SourceKey(internal.SecretReference(secret)), secret.DeepCopy())
+	} else if !v12.HasAnnotation(secret.ObjectMeta, internal.AnnotationKeyTKEAuthConfigMap) {
+		return
+	}
+
+	ctl.enqueueSource(internal.SecretReference(secret))
+	klog.V(log.VerboseLevel).Infof("received secret deleted event, namespace: %s, name: %s\n", secret.Namespace, secret.Name)
+}
+
+func (ctl *Controller) onTKEAuthBindingAdded(new interface{}) {
+	binding, ok := new.(*v1alpha1.TKEAuthBinding)
+	if !ok {
+		klog.Errorf("failed trying to cast new object to TKEAuthBinding, new: %s\n", new)
+		return
+	}
+
+	ctl.enqueueSource(internal.TKEAuthBindingReference(binding))
+	klog.V(log.VerboseLevel).Infof("received TKEAuthBinding added event, namespace: %s, name: %s\n", binding.Namespace, binding.Name)
+}
+
+func (ctl *Controller) onTKEAuthBindingUpdated(old, new interface{}) {
+	oldBinding, ok := old.(*v1alpha1.TKEAuthBinding)
+	if !ok {
+		klog.Errorf("failed trying to cast old object to TKEAuthBinding, old: %s\n", old)
+		return
+	}
+
+	binding, ok := new.(*v1alpha1.TKEAuthBinding)
+	if !ok {
+		klog.Errorf("failed trying to cast new object to TKEAuthBinding, new: %s\n", new)
+		return
+	}
+
+	// only status is updated by controller itself. same resourceVersion means periodic resync
+	deleting := (oldBinding.DeletionTimestamp == nil) != (binding.DeletionTimestamp == nil)
+	if oldBinding.ResourceVersion != binding.ResourceVersion && oldBinding.Generation == binding.Generation && !deleting {
+		return
+	}
+
+	if oldBinding.ResourceVersion == binding.ResourceVersion { // periodic resync reconciles every source
+		ctl.enqueueSync()
 	} else {
-		*timer = time.AfterFunc(reSyncWaitTimeout, ctl.syncAllClusterRoleBinding)
+		ctl.enqueueSource(internal.TKEAuthBindingReference(binding))
+	}
+	klog.V(log.VerboseLevel).Infof("received TKEAuthBinding changed event, namespace: %s, name: %s\n", binding.Namespace, binding.Name)
+}
+
+func (ctl *Controller) onTKEAuthBindingDeleted(old interface{}) {
+	if tombstone, ok := old.(cache.DeletedFinalStateUnknown); ok {
+		old = tombstone.Obj
+	}
+
+	binding, ok := old.(*v1alpha1.TKEAuthBinding)
+	if !ok {
+		klog.Errorf("failed trying to cast old object to TKEAuthBinding, old: %s\n", old)
+		return
+	}
+
+	ctl.enqueueSource(internal.TKEAuthBindingReference(binding))
+	klog.V(log.VerboseLevel).Infof("received TKEAuthBinding deleted event, namespace: %s, name: %s\n", binding.Namespace, binding.Name)
+}
+
+func (ctl *Controller) onClusterRoleBindingUpdated(old, new interface{}) {
+	crb, ok := new.(*v13.ClusterRoleBinding)
+	if !ok {
+		klog.Errorf("failed trying to cast new object to ClusterRoleBinding, new: %s\n", new)
+		return
+	}
+
+	ctl.revertDrift(crb, "ClusterRoleBinding "+crb.Name, crb.ObjectMeta, ctl.tkeAuthClusterRoleBindings.Drift(crb, false))
+}
+
+func (ctl *Controller) onClusterRoleBindingDeleted(old interface{}) {
+	if tombstone, ok := old.(cache.DeletedFinalStateUnknown); ok {
+		old = tombstone.Obj
+	}
+
+	crb, ok := old.(*v13.ClusterRoleBinding)
+	if !ok {
+		klog.Errorf("failed trying to cast old object to ClusterRoleBinding, old: %s\n", old)
+		return
 	}
+
+	ctl.revertDrift(crb, "ClusterRoleBinding "+crb.Name, crb.ObjectMeta, ctl.tkeAuthClusterRoleBindings.Drift(crb, true))
 }
 
-func (ctl *Controller) syncAllClusterRoleBinding() {
-	// 1. get all TKE-Auth config maps
+func (ctl *Controller) onRoleBindingUpdated(old, new interface{}) {
+	rb, ok := new.(*v13.RoleBinding)
+	if !ok {
+		klog.Errorf("failed trying to cast new object to RoleBinding, new: %s\n", new)
+		return
+	}
+
+	ctl.revertDrift(rb, "RoleBinding "+rb.Namespace+"/"+rb.Name, rb.ObjectMeta, ctl.tkeAuthRoleBindings.Drift(rb, false))
+}
+
+func (ctl *Controller) onRoleBindingDeleted(old interface{}) {
+	if tombstone, ok := old.(cache.DeletedFinalStateUnknown); ok {
+		old = tombstone.Obj
+	}
+
+	rb, ok := old.(*v13.RoleBinding)
+	if !ok {
+		klog.Errorf("failed trying to cast old object to RoleBinding, old: %s\n", old)
+		return
+	}
+
+	ctl.revertDrift(rb, "RoleBinding "+rb.Namespace+"/"+rb.Name, rb.ObjectMeta, ctl.tkeAuthRoleBindings.Drift(rb, true))
+}
+
+// revertDrift emits warning Event naming changes made to managed binding by others, and reconciles sources of the binding immediately.
+// sources are reconciled even if they are not changed, since the binding is changed
+func (ctl *Controller) revertDrift(obj pkgruntime.Object, name string, meta v12.ObjectMeta, changes []string) {
+	sources := internal.SourcesOf(meta)
+	if len(changes) == 0 || len(sources) == 0 {
+		return
+	}
+
+	action := "reverting"
+	if ctl.dryRun {
+		action = "would revert"
+	}
+
+	message := fmt.Sprintf("%s is changed outside of controller, %s: %s", name, action, strings.Join(changes, ", "))
+	klog.Warningln(message)
+	ctl.recordEvent(obj, v1.EventTypeWarning, EventReasonDriftReverted, message)
+
+	ctl.queue.Add(driftKeyPrefix + strings.Join(sources, ","))
+}
+
+// recordEvent records Event of object, except in dryRun mode which writes nothing to cluster. message should be logged by caller
+func (ctl *Controller) recordEvent(obj pkgruntime.Object, eventType string, reason string, message string) {
+	if ctl.dryRun {
+		return
+	}
+
+	ctl.recorder.Event(obj, eventType, reason, message)
+}
+
+// enqueueSync adds reconcile of every source to workqueue after reSyncWaitTimeout, events received until then are handled by one sync
+func (ctl *Controller) enqueueSync() {
+	ctl.queue.AddAfter(syncAllKey, reSyncWaitTimeout)
+}
+
+// enqueueSource adds reconcile of source to workqueue, only users of the source are resolved and only its bindings are applied
+func (ctl *Controller) enqueueSource(source v1.ObjectReference) {
+	ctl.queue.AddAfter(internal.SourceKey(source), reSyncWaitTimeout)
+}
+
+// runWorker processes workqueue until it is shut down
+func (ctl *Controller) runWorker() {
+	for ctl.processNextWorkItem() {
+	}
+}
+
+// processNextWorkItem runs sync of next key in workqueue, requeues the key with exponential backoff if sync fails.
+// key is SourceKey of source to reconcile, syncAllKey to reconcile every source, or drift key to reconcile sources of drifted binding.
+func (ctl *Controller) processNextWorkItem() bool {
+	key, shutdown := ctl.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer ctl.queue.Done(key)
+
+	var scope sets.String
+	drift := strings.HasPrefix(key.(string), driftKeyPrefix)
+	if drift {
+		scope = sets.NewString(strings.Split(strings.TrimPrefix(key.(string), driftKeyPrefix), ",")...)
+	} else if key != syncAllKey {
+		scope = sets.NewString(key.(string))
+	}
+
+	// plan of partial sync would overwrite plan of every source
+	if ctl.dryRun {
+		scope = nil
+	}
+
+	err := ctl.syncClusterRoleBindings(scope, drift)
+	var sourcesErr *failedSourcesError
+	if errors.As(err, &sourcesErr) { // other sources are synced, only failed sources are retried with their own backoff
+		for _, source := range sourcesErr.sources {
+			runtime.HandleError(errors.Wrapf(sourcesErr.errs[source], "sync of %s failed, requeued %d times", source, ctl.queue.NumRequeues(source)))
+			ctl.queue.AddRateLimited(source)
+		}
+
+		if !sets.NewString(sourcesErr.sources...).Has(key.(string)) {
+			ctl.queue.Forget(key)
+		}
+		return true
+	} else if err != nil {
+		runtime.HandleError(errors.Wrapf(err, "sync of %s failed, requeued %d times", key, ctl.queue.NumRequeues(key)))
+		ctl.queue.AddRateLimited(key)
+		return true
+	}
+
+	ctl.queue.Forget(key)
+	return true
+}
+
+// failedSourcesError is returned by sync which applied bindings, but some sources in its scope failed to sync
+type failedSourcesError struct {
+	// sources is SourceKey of failed sources, sorted
+	sources []string
+	errs    map[string]error
+}
+
+func (e *failedSourcesError) Error() string {
+	return fmt.Sprintf("%d sources failed to sync: %s", len(e.sources), strings.Join(e.sources, ", "))
+}
+
+// syncClusterRoleBindings applies sources in scope to bindings, every source if scope is nil. returned error requeues sync with backoff.
+// if bindings are applied but some sources in scope failed, eg: users cannot be resolved, *failedSourcesError is returned to requeue only them.
+// sources out of scope are kept untouched like failed sources, and their users are not resolved.
+// sources already synced are skipped unless force is true, eg: binding of the source is changed by others.
+// syncs are serialized by syncLock, since sources in different keys share bindings.
+func (ctl *Controller) syncClusterRoleBindings(scope sets.String, force bool) error {
+	ctl.syncLock.Lock()
+	defer ctl.syncLock.Unlock()
+
+	if scope != nil && !ctl.fullySynced {
+		klog.V(log.VerboseLevel).Infof("sources %s are reconciled with every source, first sync of every source is not succeeded yet.\n", strings.Join(scope.List(), ", "))
+		scope = nil
+	}
+
+	// errors of sources failed to sync, key is SourceKey of source object.
+	// bindings of failed sources are kept untouched, and other sources are synced.
+	failedSources := make(map[string]error)
+	// errors of bindings denied by policy, key is SourceKey of source object. other bindings of the source are synced.
+	deniedBindings := make(map[string]error)
+
+	// 1. get all TKE-Auth config maps, secrets and TKEAuthBindings
 	cfgMaps, err := ctl.tkeAuthConfigMap.GetTKEAuthConfigMaps()
-	if err != nil {
-		klog.Error(errors.Wrap(err, "Cannot get AuthConfigMaps from cluster"))
+	if err != nil { // bindings of sources not listed would be deleted
+		return errors.Wrap(err, "Cannot get AuthConfigMaps from cluster, aborting sync")
 	}
 	klog.V(log.VerboseLevel).Infof("got %d configMaps.\n", len(cfgMaps))
 
+	secrets, err := ctl.tkeAuthSecrets.GetTKEAuthSecrets()
+	if err != nil { // bindings of sources not listed would be deleted
+		return errors.Wrap(err, "Cannot get AuthSecrets from cluster, aborting sync")
+	}
+	klog.V(log.VerboseLevel).Infof("got %d secrets.\n", len(secrets))
+
+	bindings, err := ctl.tkeAuthBindings.GetTKEAuthBindings()
+	if err != nil { // bindings of sources not listed would be deleted
+		return errors.Wrap(err, "Cannot get TKEAuthBindings from cluster, aborting sync")
+	}
+	klog.V(log.VerboseLevel).Infof("got %d TKEAuthBindings.\n", len(bindings))
+
+	groupCfgMaps, err := ctl.tkeAuthConfigMap.GetUserGroupConfigMaps()
+	if err != nil { // users of groups not listed would be removed
+		return errors.Wrap(err, "Cannot get user groups from cluster, aborting sync")
+	}
+	userGroups, userGroupErrs := internal.ToUserGroups(groupCfgMaps)
+	for name, err := range userGroupErrs {
+		klog.Errorf("user group %s cannot be used, err: %s\n", name, err)
+	}
+	klog.V(log.VerboseLevel).Infof("got %d user groups.\n", len(userGroups))
+
+	// sources deleted or "tke-auth/binding" annotation removed, waiting for their bindings to be revoked
+	cfgMaps, secrets, bindings, released := ctl.splitReleasedSources(cfgMaps, secrets, bindings)
+	// add finalizer before bindings are created, so that they are revoked when source is deleted.
+	// resourceVersions of sources are updated by finalizer patch, and recorded as synced below
+	if !ctl.dryRun {
+		ctl.addFinalizers(cfgMaps, secrets, bindings)
+	}
+
+	versions := sourceVersions(cfgMaps, secrets, bindings)
+	if scope != nil {
+		if !force && ctl.isSynced(scope, versions) { // event of object already applied, eg: initial list of informer
+			klog.V(log.VerboseLevel).Infof("sources %s are already synced, skipping.\n", strings.Join(scope.List(), ", "))
+			return nil
+		}
+
+		// released sources are reconciled with scope, to revoke their bindings and remove finalizer
+		scope = scope.Union(releasedSourceKeys(released))
+		klog.Infof("reconciling sources: %s\n", strings.Join(scope.List(), ", "))
+	}
+
 	// 2. convert to tkeAuth
 	tkeAuths := make([]*internal.TKEAuth, 0)
 	for _, cfg := range cfgMaps {
-		tkeAuth, err := internal.ToTKEAuth(cfg)
+		// source with invalid entry is failed as a whole, its existing bindings are kept instead of applying valid entries only
+		cfgTKEAuths, errs := internal.ToTKEAuths(cfg)
+		if len(errs) > 0 {
+			ctl.recordSourceError(failedSources, scope, internal.ConfigMapReference(cfg), utilerrors.NewAggregate(errs))
+		} else {
+			tkeAuths = append(tkeAuths, cfgTKEAuths...)
+		}
+	}
+
+	for _, secret := range secrets {
+		secretTKEAuths, errs := internal.SecretToTKEAuths(secret)
+		if len(errs) > 0 {
+			ctl.recordSourceError(failedSources, scope, internal.SecretReference(secret), utilerrors.NewAggregate(errs))
+		} else {
+			tkeAuths = append(tkeAuths, secretTKEAuths...)
+		}
+	}
+
+	for _, binding := range bindings {
+		tkeAuth, err := internal.BindingToTKEAuth(binding)
 		if err != nil {
-			klog.Error(err)
-			return
+			ctl.recordSourceError(failedSources, scope, internal.TKEAuthBindingReference(binding), err)
 		} else {
 			tkeAuths = append(tkeAuths, tkeAuth)
 		}
 	}
 
-	// 3. convert subAccountId to CommonNames
+	policy, err := ctl.policySource.Load()
+	if err != nil {
+		return errors.Wrap(err, "Cannot load policy, aborting sync")
+	}
+
+	// 3. expand user groups, validate users and referenced role, skip bindings denied by policy
+	for _, tkeAuth := range tkeAuths {
+		err := tkeAuth.ExpandUserGroups(userGroups, userGroupErrs)
+		if err == nil {
+			err = tkeAuth.Validate(ctl.namespaceLister)
+		}
+		if err == nil {
+			err = ctl.tkeAuthRoles.CheckRoleRefExists(tkeAuth)
+		}
+		if err == nil && ctl.requireNamespacePrefix {
+			err = tkeAuth.CheckNamespacePrefix()
+		}
+
+		if err != nil {
+			ctl.recordSourceError(failedSources, scope, tkeAuth.Source, err)
+		}
+	}
+	tkeAuths = excludeFailedSources(tkeAuths, failedSources)
+	tkeAuths = ctl.excludeDeniedBindings(tkeAuths, policy, scope, deniedBindings)
+
+	// skip bindings and users out of notBefore and expiresAt, and reserve sync when they change.
+	// subjects kept in bindings of failed sources are also revoked at their expiry
+	now := time.Now()
+	crbExpiry, err := ctl.tkeAuthClusterRoleBindings.NextSubjectExpiry(now)
+	if err != nil {
+		return errors.Wrap(err, "Cannot get expiry of ClusterRoleBindings, aborting sync")
+	}
+	rbExpiry, err := ctl.tkeAuthRoleBindings.NextSubjectExpiry(now)
+	if err != nil {
+		return errors.Wrap(err, "Cannot get expiry of RoleBindings, aborting sync")
+	}
+	ctl.reserveTransitionTimer(internal.EarliestTime(internal.NextTransition(tkeAuths, now), crbExpiry, rbExpiry), now)
+	expired := make(map[string][]string)
+	tkeAuths = excludeInactiveBindings(tkeAuths, now, expired)
+
+	// 4. reject sources taking over objects owned by another namespace, and sources claiming same binding by conflict policy
+	owners, err := ctl.getOwners()
+	if err != nil {
+		return errors.Wrap(err, "Cannot get owners of managed objects, aborting sync")
+	}
+
+	for sourceKey, err := range internal.CheckOwnership(tkeAuths, owners) {
+		ctl.recordSourceError(failedSources, scope, sourceOf(tkeAuths, sourceKey), err)
+	}
+	tkeAuths = excludeFailedSources(tkeAuths, failedSources)
+
+	for sourceKey, err := range internal.DetectConflicts(tkeAuths, ctl.conflictPolicy) {
+		ctl.recordSourceError(failedSources, scope, sourceOf(tkeAuths, sourceKey), err)
+	}
+	tkeAuths = excludeFailedSources(tkeAuths, failedSources)
+
+	// existing bindings not managed by controller are handled by adopt policy of source
+	unmanaged, err := ctl.getUnmanaged()
+	if err != nil {
+		return errors.Wrap(err, "Cannot get unmanaged bindings, aborting sync")
+	}
+
+	tkeAuths, adoptions, adoptErrs := internal.CheckAdoption(tkeAuths, unmanaged, policy)
+	for sourceKey, err := range adoptErrs {
+		ctl.recordSourceError(failedSources, scope, sourceOf(tkeAuths, sourceKey), err)
+	}
+	tkeAuths = excludeFailedSources(tkeAuths, failedSources)
+
+	// only users of sources in scope are resolved
+	tkeAuths = includeSources(tkeAuths, scope)
+
+	// 5. convert subAccountId to CommonNames
 	for _, tkeAuth := range tkeAuths {
 		err := (ctl.commonNameResolver).ResolveCommonNames(tkeAuth.Users)
 		if err != nil {
-			klog.Error(err)
-			return
+			ctl.recordSourceError(failedSources, scope, tkeAuth.Source, err)
 		}
 	}
+	tkeAuths = excludeFailedSources(tkeAuths, failedSources)
+
+	ctl.setSyncErrors(failedSources, scope)
+	failedInScope := filterScope(sets.StringKeySet(failedSources), scope)
+	if failedInScope.Len() > 0 {
+		klog.Warningf("%d sources failed to sync, keeping their bindings untouched: %s\n", failedInScope.Len(), strings.Join(failedInScope.List(), ", "))
+	}
+
+	skipSources := sets.StringKeySet(failedSources)
+	if scope != nil { // bindings of sources out of scope are kept untouched, including subjects of them in merged bindings
+		skipSources = skipSources.Union(sets.StringKeySet(versions).Difference(scope))
+	}
+
+	// expired subjects are revoked from bindings kept for failed sources and sources out of scope
+	expireSources := skipSources
 
-	// 4. convert to ClusterRoleBinding
+	// bindings of released sources with "tke-auth/orphan-on-delete" are kept and released, others are deleted as they are not claimed anymore
+	skipSources = skipSources.Union(orphanSourceKeys(released))
+
+	// 6. convert to ClusterRoleBinding, or RoleBindings if namespaces are given
 	TKEAuthCRBs := make([]*v13.ClusterRoleBinding, 0)
+	TKEAuthRBs := make([]*v13.RoleBinding, 0)
 	for _, tkeAuth := range tkeAuths {
-		crb := tkeAuth.ToClusterRoleBinding()
-		TKEAuthCRBs = append(TKEAuthCRBs, crb)
+		if tkeAuth.IsNamespaced() {
+			TKEAuthRBs = append(TKEAuthRBs, tkeAuth.ToRoleBindings()...)
+		} else {
+			crb := tkeAuth.ToClusterRoleBinding()
+			TKEAuthCRBs = append(TKEAuthCRBs, crb)
+		}
+	}
+
+	// bindings shared by multiple sources in merge mode
+	TKEAuthCRBs = internal.MergeClusterRoleBindings(TKEAuthCRBs)
+	TKEAuthRBs = internal.MergeRoleBindings(TKEAuthRBs)
+
+	TKEAuthCRs := make([]*v13.ClusterRole, 0)
+	for _, tkeAuth := range tkeAuths {
+		if tkeAuth.HasRules() {
+			TKEAuthCRs = append(TKEAuthCRs, tkeAuth.ToClusterRole())
+		}
+	}
+
+	// 7. plan changes of ClusterRoles, CRBs and RBs, refuse sync deleting too many bindings before anything is written
+	crPlan, err := ctl.tkeAuthRoles.PlanClusterRoles(TKEAuthCRs, skipSources)
+	if err != nil {
+		return errors.Wrap(err, "Cannot plan ClusterRoles, aborting sync")
+	}
+
+	crbPlan, err := ctl.tkeAuthClusterRoleBindings.PlanClusterRoleBindings(TKEAuthCRBs, skipSources, expireSources, adoptions)
+	if err != nil {
+		return errors.Wrap(err, "Cannot plan ClusterRoleBindings, aborting sync")
+	}
+
+	rbPlan, err := ctl.tkeAuthRoleBindings.PlanRoleBindings(TKEAuthRBs, skipSources, expireSources, adoptions)
+	if err != nil {
+		return errors.Wrap(err, "Cannot plan RoleBindings, aborting sync")
+	}
+
+	guardErr := ctl.deletionGuard.Check(crPlan, crbPlan, rbPlan)
+	if ctl.dryRun {
+		ctl.reportPlan(internal.NewSyncPlan(crPlan, crbPlan, rbPlan), guardErr)
+		return nil
+	}
+
+	if err := guardErr; err != nil {
+		ctl.updateSyncStatus(cfgMaps, secrets, bindings, tkeAuths, scope, failedSources, deniedBindings, expired, err)
+		return err
+	}
+
+	if err := ctl.orphanReleasedSources(released); err != nil {
+		return errors.Wrap(err, "Cannot orphan bindings of released sources, aborting sync")
+	}
+
+	// 8. apply ClusterRoles created from rules, before bindings refer them
+	err = ctl.tkeAuthRoles.ApplyClusterRoles(crPlan)
+	if err != nil {
+		ctl.updateSyncStatus(cfgMaps, secrets, bindings, tkeAuths, scope, failedSources, deniedBindings, expired, err)
+		return err
+	} else {
+		klog.Infoln("ClusterRoles updated.")
 	}
 
-	// 5. upsert CRBs
-	err = ctl.tkeAuthClusterRoleBindings.UpsertClusterRoleBindings(TKEAuthCRBs)
+	// 9. apply CRBs
+	err = ctl.tkeAuthClusterRoleBindings.ApplyClusterRoleBindings(crbPlan)
 	if err != nil {
 		klog.Error(err)
 	} else {
 		klog.Infoln("ClusterRoleBindings updated.")
 	}
+
+	// 10. apply RBs
+	rbErr := ctl.tkeAuthRoleBindings.ApplyRoleBindings(rbPlan)
+	if rbErr != nil {
+		klog.Error(rbErr)
+	} else {
+		klog.Infoln("RoleBindings updated.")
+	}
+
+	// 11. write result of sync to source objects
+	applyErr := utilerrors.NewAggregate([]error{err, rbErr})
+	ctl.updateSyncStatus(cfgMaps, secrets, bindings, tkeAuths, scope, failedSources, deniedBindings, expired, applyErr)
+
+	// 12. remove finalizer of released sources after their bindings are revoked
+	if applyErr == nil {
+		ctl.removeFinalizers(released)
+		// resourceVersions are updated by status patches, events of them are regarded as already synced
+		ctl.setSyncedVersions(sourceVersions(cfgMaps, secrets, bindings), scope, failedSources)
+	}
+
+	if applyErr == nil && failedInScope.Len() > 0 {
+		errs := make(map[string]error)
+		for _, key := range failedInScope.List() {
+			errs[key] = failedSources[key]
+		}
+		return &failedSourcesError{sources: failedInScope.List(), errs: errs}
+	}
+
+	return applyErr
+}
+
+// reportPlan logs plan of sync in dryRun mode, and writes it to planFile if given.
+// guardErr is error of DeletionGuard, which would refuse the sync.
+func (ctl *Controller) reportPlan(plan *internal.SyncPlan, guardErr error) {
+	if guardErr != nil {
+		plan.Refused = guardErr.Error()
+	}
+
+	buf, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		klog.Errorf("cannot marshal plan, err: %s\n", err)
+		return
+	}
+
+	klog.Infof("[dry-run] planned changes. add: %d, update: %d, delete: %d, refused: %t\n%s\n", len(plan.Additions), len(plan.Updates), len(plan.Deletions), guardErr != nil, buf)
+
+	if ctl.planFile == "" {
+		return
+	}
+
+	if err := ioutil.WriteFile(ctl.planFile, buf, 0644); err != nil {
+		klog.Errorf("cannot write plan to %s, err: %s\n", ctl.planFile, err)
+	}
+}
+
+// releasedSource is source object deleted or "tke-auth/binding" annotation removed, which still has finalizer
+type releasedSource struct {
+	source v1.ObjectReference
+	// orphan keeps bindings of source instead of deleting them
+	orphan bool
+	// removeFinalizer lets source object be deleted
+	removeFinalizer func() error
+}
+
+// splitReleasedSources returns sources to sync, and released sources whose bindings should be revoked
+func (ctl *Controller) splitReleasedSources(cfgMaps []*v1.ConfigMap, secrets []*v1.Secret, bindings []*v1alpha1.TKEAuthBinding) ([]*v1.ConfigMap, []*v1.Secret, []*v1alpha1.TKEAuthBinding, []releasedSource) {
+	released := make([]releasedSource, 0)
+
+	liveCfgMaps := make([]*v1.ConfigMap, 0)
+	for _, cfgMap := range cfgMaps {
+		if !internal.IsReleased(cfgMap.ObjectMeta) {
+			liveCfgMaps = append(liveCfgMaps, cfgMap)
+			continue
+		}
+
+		cfgMap := cfgMap
+		released = append(released, releasedSource{
+			source:          internal.ConfigMapReference(cfgMap),
+			orphan:          internal.IsOrphanOnDelete(cfgMap.ObjectMeta),
+			removeFinalizer: func() error { return ctl.tkeAuthConfigMap.SetFinalizer(cfgMap, false) },
+		})
+	}
+
+	liveSecrets := make([]*v1.Secret, 0)
+	for _, secret := range secrets {
+		if !internal.IsReleased(secret.ObjectMeta) {
+			liveSecrets = append(liveSecrets, secret)
+			continue
+		}
+
+		secret := secret
+		released = append(released, releasedSource{
+			source:          internal.SecretReference(secret),
+			orphan:          internal.IsOrphanOnDelete(secret.ObjectMeta),
+			removeFinalizer: func() error { return ctl.tkeAuthSecrets.SetFinalizer(secret, false) },
+		})
+	}
+
+	watchedSecrets := sets.NewString()
+	for _, secret := range secrets {
+		watchedSecrets.Insert(internal.SourceKey(internal.SecretReference(secret)))
+	}
+
+	for key, secret := range ctl.getUnwatchedSecrets() {
+		if watchedSecrets.Has(key) { // label is added again, waiting for added event
+			continue
+		}
+
+		key, secret := key, secret
+		released = append(released, releasedSource{
+			source: internal.SecretReference(secret),
+			orphan: internal.IsOrphanOnDelete(secret.ObjectMeta),
+			removeFinalizer: func() error {
+				err := ctl.tkeAuthSecrets.SetFinalizer(secret, false)
+				if err == nil || apierrors.IsNotFound(errors.Cause(err)) {
+					ctl.setUnwatchedSecret(key, nil)
+				}
+				return err
+			},
+		})
+	}
+
+	liveBindings := make([]*v1alpha1.TKEAuthBinding, 0)
+	for _, binding := range bindings {
+		if binding.DeletionTimestamp == nil {
+			liveBindings = append(liveBindings, binding)
+			continue
+		}
+
+		if !internal.HasFinalizer(binding.ObjectMeta) { // finalizer is already removed, waiting for deletion
+			continue
+		}
+
+		binding := binding
+		released = append(released, releasedSource{
+			source:          internal.TKEAuthBindingReference(binding),
+			orphan:          internal.IsOrphanOnDelete(binding.ObjectMeta),
+			removeFinalizer: func() error { return ctl.tkeAuthBindings.SetFinalizer(binding, false) },
+		})
+	}
+
+	for _, r := range released {
+		klog.Infof("source %s is released, orphan: %t\n", internal.SourceKey(r.source), r.orphan)
+	}
+
+	return liveCfgMaps, liveSecrets, liveBindings, released
+}
+
+// setUnwatchedSecret records secret whose label is removed, or forgets it if secret is nil
+func (ctl *Controller) setUnwatchedSecret(key string, secret *v1.Secret) {
+	ctl.unwatchedSecretsLock.Lock()
+	defer ctl.unwatchedSecretsLock.Unlock()
+
+	if secret == nil {
+		delete(ctl.unwatchedSecrets, key)
+	} else {
+		ctl.unwatchedSecrets[key] = secret
+	}
+}
+
+// getUnwatchedSecrets returns copy of unwatchedSecrets
+func (ctl *Controller) getUnwatchedSecrets() map[string]*v1.Secret {
+	ctl.unwatchedSecretsLock.Lock()
+	defer ctl.unwatchedSecretsLock.Unlock()
+
+	ret := make(map[string]*v1.Secret)
+	for key, secret := range ctl.unwatchedSecrets {
+		ret[key] = secret
+	}
+
+	return ret
+}
+
+// orphanSourceKeys returns SourceKey of released sources with orphan enabled
+func orphanSourceKeys(released []releasedSource) sets.String {
+	sources := sets.NewString()
+	for _, r := range released {
+		if r.orphan {
+			sources.Insert(internal.SourceKey(r.source))
+		}
+	}
+
+	return sources
+}
+
+// orphanReleasedSources removes annotations of controller from objects created only from released sources with orphan enabled
+func (ctl *Controller) orphanReleasedSources(released []releasedSource) error {
+	sources := orphanSourceKeys(released)
+	if sources.Len() == 0 {
+		return nil
+	}
+
+	if err := ctl.tkeAuthClusterRoleBindings.ReleaseClusterRoleBindings(sources); err != nil {
+		return err
+	}
+
+	if err := ctl.tkeAuthRoleBindings.ReleaseRoleBindings(sources); err != nil {
+		return err
+	}
+
+	return ctl.tkeAuthRoles.ReleaseClusterRoles(sources)
+}
+
+// removeFinalizers removes finalizer of released sources, so that deletion of them is completed
+func (ctl *Controller) removeFinalizers(released []releasedSource) {
+	for _, r := range released {
+		if err := r.removeFinalizer(); err != nil {
+			klog.Error(err)
+		}
+	}
+}
+
+// addFinalizers adds finalizer to sources, so that their bindings are revoked before they are deleted
+func (ctl *Controller) addFinalizers(cfgMaps []*v1.ConfigMap, secrets []*v1.Secret, bindings []*v1alpha1.TKEAuthBinding) {
+	for _, cfgMap := range cfgMaps {
+		if !internal.HasFinalizer(cfgMap.ObjectMeta) {
+			if err := ctl.tkeAuthConfigMap.SetFinalizer(cfgMap, true); err != nil {
+				klog.Error(err)
+			}
+		}
+	}
+
+	for _, secret := range secrets {
+		if !internal.HasFinalizer(secret.ObjectMeta) {
+			if err := ctl.tkeAuthSecrets.SetFinalizer(secret, true); err != nil {
+				klog.Error(err)
+			}
+		}
+	}
+
+	for _, binding := range bindings {
+		if !internal.HasFinalizer(binding.ObjectMeta) {
+			if err := ctl.tkeAuthBindings.SetFinalizer(binding, true); err != nil {
+				klog.Error(err)
+			}
+		}
+	}
+}
+
+// getOwners returns namespaces owning every managed ClusterRoleBinding, RoleBinding and ClusterRole
+func (ctl *Controller) getOwners() (internal.Owners, error) {
+	owners := make(internal.Owners)
+
+	crbOwners, err := ctl.tkeAuthClusterRoleBindings.Owners()
+	if err != nil {
+		return nil, err
+	}
+
+	rbOwners, err := ctl.tkeAuthRoleBindings.Owners()
+	if err != nil {
+		return nil, err
+	}
+
+	crOwners, err := ctl.tkeAuthRoles.Owners()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, o := range []internal.Owners{crbOwners, rbOwners, crOwners} {
+		for key, namespaces := range o {
+			owners[key] = namespaces
+		}
+	}
+
+	return owners, nil
 }
 
-func (ctl *Controller) Run(stopCh <-chan struct{}) error {
+// getUnmanaged returns roleRef of existing CRBs and RBs not managed by controller, key is conflict key of TKEAuth
+func (ctl *Controller) getUnmanaged() (internal.Unmanaged, error) {
+	unmanaged := make(internal.Unmanaged)
+
+	crbUnmanaged, err := ctl.tkeAuthClusterRoleBindings.Unmanaged()
+	if err != nil {
+		return nil, err
+	}
+
+	rbUnmanaged, err := ctl.tkeAuthRoleBindings.Unmanaged()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, u := range []internal.Unmanaged{crbUnmanaged, rbUnmanaged} {
+		for key, roleRef := range u {
+			unmanaged[key] = roleRef
+		}
+	}
+
+	return unmanaged, nil
+}
+
+// updateSyncStatus writes status of sync to every source object.
+// deniedBindings and applyErr are reported to source not failed, applyErr is error of applying bindings to cluster.
+func (ctl *Controller) updateSyncStatus(cfgMaps []*v1.ConfigMap, secrets []*v1.Secret, bindings []*v1alpha1.TKEAuthBinding, tkeAuths []*internal.TKEAuth, scope sets.String, failedSources map[string]error, deniedBindings map[string]error, expired map[string][]string, applyErr error) {
+	tkeAuthsBySource := make(map[string][]*internal.TKEAuth)
+	for _, tkeAuth := range tkeAuths {
+		key := internal.SourceKey(tkeAuth.Source)
+		tkeAuthsBySource[key] = append(tkeAuthsBySource[key], tkeAuth)
+	}
+
+	newSyncStatus := func(source v1.ObjectReference) *internal.SyncStatus {
+		key := internal.SourceKey(source)
+		status := internal.NewSyncStatus(source, tkeAuthsBySource[key], expired[key], failedSources[key])
+		if err := utilerrors.NewAggregate([]error{deniedBindings[key], applyErr}); !status.Failed && err != nil {
+			status.LastError = err.Error()
+		}
+
+		return status
+	}
+
+	for _, cfgMap := range cfgMaps {
+		if !inScope(scope, internal.SourceKey(internal.ConfigMapReference(cfgMap))) {
+			continue
+		}
+
+		err := ctl.tkeAuthConfigMap.UpdateStatus(cfgMap, newSyncStatus(internal.ConfigMapReference(cfgMap)))
+		if err != nil {
+			klog.Error(err)
+		}
+	}
+
+	for _, secret := range secrets {
+		if !inScope(scope, internal.SourceKey(internal.SecretReference(secret))) {
+			continue
+		}
+
+		err := ctl.tkeAuthSecrets.UpdateStatus(secret, newSyncStatus(internal.SecretReference(secret)))
+		if err != nil {
+			klog.Error(err)
+		}
+	}
+
+	for _, binding := range bindings {
+		if !inScope(scope, internal.SourceKey(internal.TKEAuthBindingReference(binding))) {
+			continue
+		}
+
+		err := ctl.tkeAuthBindings.UpdateStatus(binding, newSyncStatus(internal.TKEAuthBindingReference(binding)))
+		if err != nil {
+			klog.Error(err)
+		}
+	}
+}
+
+// recordSourceError logs error, emits warning Event to source object and adds error to failedSources.
+// error of source out of scope is only added to failedSources, it is reported when the source is reconciled.
+func (ctl *Controller) recordSourceError(failedSources map[string]error, scope sets.String, source v1.ObjectReference, err error) {
+	key := internal.SourceKey(source)
+	if !inScope(scope, key) {
+		failedSources[key] = utilerrors.NewAggregate([]error{failedSources[key], err})
+		return
+	}
+
+	klog.Errorf("source %s failed to sync, err: %s\n", key, err)
+	ctl.recordEvent(&source, v1.EventTypeWarning, EventReasonSyncFailed, err.Error())
+
+	if prevErr, ok := failedSources[key]; ok {
+		err = utilerrors.NewAggregate([]error{prevErr, err})
+	}
+	failedSources[key] = err
+}
+
+// excludeDeniedBindings returns tkeAuths allowed by policy.
+// denied bindings are reported to source, and removed from cluster like bindings deleted from source.
+func (ctl *Controller) excludeDeniedBindings(tkeAuths []*internal.TKEAuth, policy *internal.Policy, scope sets.String, deniedBindings map[string]error) []*internal.TKEAuth {
+	ret := make([]*internal.TKEAuth, 0)
+
+	for _, tkeAuth := range tkeAuths {
+		err := policy.Check(tkeAuth)
+		if err == nil {
+			ret = append(ret, tkeAuth)
+			continue
+		}
+
+		key := internal.SourceKey(tkeAuth.Source)
+		if inScope(scope, key) {
+			klog.Warningf("source %s, %s\n", key, err)
+			ctl.recordEvent(&tkeAuth.Source, v1.EventTypeWarning, EventReasonPolicyDenied, err.Error())
+		}
+		deniedBindings[key] = utilerrors.NewAggregate([]error{deniedBindings[key], err})
+	}
+
+	return ret
+}
+
+// excludeInactiveBindings returns tkeAuths granted at now, with users granted at now.
+// expired bindings and users are added to expired, key is SourceKey of source object.
+func excludeInactiveBindings(tkeAuths []*internal.TKEAuth, now time.Time, expired map[string][]string) []*internal.TKEAuth {
+	ret := make([]*internal.TKEAuth, 0)
+
+	for _, tkeAuth := range tkeAuths {
+		key := internal.SourceKey(tkeAuth.Source)
+
+		if !tkeAuth.IsActive(now) {
+			if tkeAuth.IsExpired(now) {
+				expired[key] = append(expired[key], tkeAuth.BindingName)
+			}
+			continue
+		}
+
+		expired[key] = append(expired[key], tkeAuth.ExcludeInactiveUsers(now)...)
+		ret = append(ret, tkeAuth)
+	}
+
+	return ret
+}
+
+// reserveTransitionTimer reserves sync at next, replacing previous reservation. nothing is reserved if next is zero
+func (ctl *Controller) reserveTransitionTimer(next time.Time, now time.Time) {
+	if ctl.transitionTimer != nil {
+		ctl.transitionTimer.Stop()
+	}
+
+	if next.IsZero() {
+		return
+	}
+
+	klog.V(log.VerboseLevel).Infof("next sync by notBefore or expiresAt is reserved at %s\n", next.Format(time.RFC3339))
+	ctl.transitionTimer = time.AfterFunc(next.Sub(now), ctl.enqueueSync)
+}
+
+// sourceOf returns source reference of tkeAuth which has given sourceKey
+func sourceOf(tkeAuths []*internal.TKEAuth, sourceKey string) v1.ObjectReference {
+	for _, tkeAuth := range tkeAuths {
+		if internal.SourceKey(tkeAuth.Source) == sourceKey {
+			return tkeAuth.Source
+		}
+	}
+
+	return v1.ObjectReference{}
+}
+
+// excludeFailedSources returns tkeAuths whose source is not in failedSources
+func excludeFailedSources(tkeAuths []*internal.TKEAuth, failedSources map[string]error) []*internal.TKEAuth {
+	ret := make([]*internal.TKEAuth, 0)
+
+	for _, tkeAuth := range tkeAuths {
+		if _, ok := failedSources[internal.SourceKey(tkeAuth.Source)]; !ok {
+			ret = append(ret, tkeAuth)
+		}
+	}
+
+	return ret
+}
+
+// setSyncErrors replaces errors of sources in scope with failedSources, every error if scope is nil
+func (ctl *Controller) setSyncErrors(failedSources map[string]error, scope sets.String) {
+	ctl.syncErrorsLock.Lock()
+	defer ctl.syncErrorsLock.Unlock()
+
+	if scope == nil {
+		ctl.syncErrors = failedSources
+		return
+	}
+
+	for key := range scope {
+		delete(ctl.syncErrors, key)
+		if err, ok := failedSources[key]; ok {
+			ctl.syncErrors[key] = err
+		}
+	}
+}
+
+// SyncErrors returns errors of sources failed on last sync, key is "Kind/namespace/name" of source
+func (ctl *Controller) SyncErrors() map[string]error {
+	ctl.syncErrorsLock.RLock()
+	defer ctl.syncErrorsLock.RUnlock()
+
+	ret := make(map[string]error)
+	for key, err := range ctl.syncErrors {
+		ret[key] = err
+	}
+
+	return ret
+}
+
+// Run starts workers after caches are synced, and blocks until stopCh is closed
+func (ctl *Controller) Run(workers int, stopCh <-chan struct{}) error {
 	defer runtime.HandleCrash()
+	defer ctl.queue.ShutDown()
 
 	klog.Infoln("Starting Controller.")
 
 	klog.V(4).Infoln("Waiting for informer caches to sync.")
-	if ok := cache.WaitForCacheSync(stopCh, ctl.tkeAuthConfigMap.Synced, ctl.tkeAuthClusterRoleBindings.Synced); !ok {
+	if ok := cache.WaitForCacheSync(stopCh, ctl.tkeAuthConfigMap.Synced, ctl.tkeAuthSecrets.Synced, ctl.tkeAuthBindings.Synced, ctl.tkeAuthClusterRoleBindings.Synced, ctl.tkeAuthRoleBindings.Synced, ctl.tkeAuthRoles.ClusterRoleSynced, ctl.tkeAuthRoles.RoleSynced, ctl.namespaceSynced); !ok {
 		return fmt.Errorf("Failed to wait for caches to sync.\n")
 	}
 
-	klog.Infoln("Controller running...")
+	// reconcile every source first, events of initial list are skipped as their sources are already synced
+	ctl.queue.Add(syncAllKey)
+	for i := 0; i < workers; i++ {
+		go wait.Until(ctl.runWorker, time.Second, stopCh)
+	}
+
+	klog.Infof("Controller running with %d workers...\n", workers)
 	<-stopCh
 	klog.Infoln("Controller stopped.")
 
 	return nil
 }
+
+// sourceVersions returns resourceVersion of sources, key is SourceKey
+func sourceVersions(cfgMaps []*v1.ConfigMap, secrets []*v1.Secret, bindings []*v1alpha1.TKEAuthBinding) map[string]string {
+	versions := make(map[string]string)
+
+	for _, cfgMap := range cfgMaps {
+		versions[internal.SourceKey(internal.ConfigMapReference(cfgMap))] = cfgMap.ResourceVersion
+	}
+
+	for _, secret := range secrets {
+		versions[internal.SourceKey(internal.SecretReference(secret))] = secret.ResourceVersion
+	}
+
+	for _, binding := range bindings {
+		versions[internal.SourceKey(internal.TKEAuthBindingReference(binding))] = binding.ResourceVersion
+	}
+
+	return versions
+}
+
+// isSynced returns true if every source in scope exists and is applied by previous sync with same resourceVersion
+func (ctl *Controller) isSynced(scope sets.String, versions map[string]string) bool {
+	for key := range scope {
+		version, ok := versions[key]
+		if !ok || ctl.syncedVersions[key] != version {
+			return false
+		}
+	}
+
+	return true
+}
+
+// setSyncedVersions records resourceVersion of sources in scope applied without failure
+func (ctl *Controller) setSyncedVersions(versions map[string]string, scope sets.String, failedSources map[string]error) {
+	if scope == nil {
+		ctl.syncedVersions = make(map[string]string)
+		ctl.fullySynced = true
+	}
+
+	for key, version := range versions {
+		if !inScope(scope, key) {
+			continue
+		}
+
+		if _, failed := failedSources[key]; failed {
+			delete(ctl.syncedVersions, key)
+			continue
+		}
+
+		ctl.syncedVersions[key] = version
+	}
+}
+
+// releasedSourceKeys returns SourceKey of released sources
+func releasedSourceKeys(released []releasedSource) sets.String {
+	keys := sets.NewString()
+	for _, r := range released {
+		keys.Insert(internal.SourceKey(r.source))
+	}
+
+	return keys
+}
+
+// inScope returns true if source is reconciled by sync of scope. nil scope contains every source
+func inScope(scope sets.String, key string) bool {
+	return scope == nil || scope.Has(key)
+}
+
+// filterScope returns keys in scope
+func filterScope(keys sets.String, scope sets.String) sets.String {
+	if scope == nil {
+		return keys
+	}
+
+	return keys.Intersection(scope)
+}
+
+// includeSources returns tkeAuths whose source is in scope
+func includeSources(tkeAuths []*internal.TKEAuth, scope sets.String) []*internal.TKEAuth {
+	ret := make([]*internal.TKEAuth, 0)
+
+	for _, tkeAuth := range tkeAuths {
+		if inScope(scope, internal.SourceKey(tkeAuth.Source)) {
+			ret = append(ret, tkeAuth)
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,22 @@
+#!/usr/bin/env bash
+
+# generates deepcopy, clientset, informers and listers of internal/apis into internal/generated
+# usage: ./hack/update-codegen.sh (run on repository root)
+
+set -o errexit
+set -o nounset
+set -o pipefail
+
+MODULE=example.com/tke-auth-controller
+SCRIPT_ROOT=$(dirname "${BASH_SOURCE[0]}")/..
+CODEGEN_PKG=${CODEGEN_PKG:-$(go env GOMODCACHE)/k8s.io/code-generator@v0.22.1}
+OUTPUT_BASE=$(mktemp -d)
+trap 'rm -rf "${OUTPUT_BASE}"' EXIT
+
+bash "${CODEGEN_PKG}"/generate-groups.sh "deepcopy,client,informer,lister" \
+  ${MODULE}/internal/generated ${MODULE}/internal/apis \
+  tkeauth:v1alpha1 \
+  --output-base "${OUTPUT_BASE}" \
+  --go-header-file "${SCRIPT_ROOT}"/hack/boilerplate.go.txt
+
+cp -r "${OUTPUT_BASE}/${MODULE}/internal/." "${SCRIPT_ROOT}/internal/"
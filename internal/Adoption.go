@@ -0,0 +1,316 @@
+package internal
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	v14 "k8s.io/api/rbac/v1"
+	v15 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"strings"
+)
+
+const (
+	// AdoptPolicyFail fails the source if binding of same name exists without managed annotation. default
+	AdoptPolicyFail = "fail"
+	// AdoptPolicySkip keeps existing binding untouched and does not create the binding, other bindings of the source are synced
+	AdoptPolicySkip = "skip"
+	// AdoptPolicyOverwrite takes existing binding under management, subjects are replaced with users of source
+	AdoptPolicyOverwrite = "overwrite"
+	// AdoptPolicyMerge takes existing binding under management, existing subjects are kept along with users of source
+	AdoptPolicyMerge = "merge"
+
+	// AnnotationKeyAdoptedSubjects is subjects of binding before adopted with AdoptPolicyMerge, kept in every sync.
+	// value is json list of subjects.
+	AnnotationKeyAdoptedSubjects = "tke-auth/adopted-subjects"
+)
+
+// AdoptPolicies is list of valid adopt policies
+var AdoptPolicies = []string{AdoptPolicyFail, AdoptPolicySkip, AdoptPolicyOverwrite, AdoptPolicyMerge}
+
+// Unmanaged is roleRef of existing bindings without managed annotation, key is same as conflict key of TKEAuth. eg: "ClusterRoleBinding/name"
+type Unmanaged map[string]v14.RoleRef
+
+// Adoptions is adopt policy of unmanaged bindings to take over, key is same as conflict key of TKEAuth
+type Adoptions map[string]string
+
+// adoptPolicy returns adopt policy of TKEAuth, AdoptPolicyFail if not provided
+func (t *TKEAuth) adoptPolicy() string {
+	if t.Adopt == "" {
+		return AdoptPolicyFail
+	}
+
+	return t.Adopt
+}
+
+// bindingKeys returns conflict keys of bindings created from TKEAuth, ClusterRole is not included
+func (t *TKEAuth) bindingKeys() []string {
+	keys := make([]string, 0)
+	for _, key := range t.conflictKeys() {
+		if !strings.HasPrefix(key, "ClusterRole/") {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// CheckAdoption decides how TKEAuths claiming unmanaged bindings are handled by adopt policy of each TKEAuth.
+// taking over unmanaged binding should be allowed by AllowAdopt of policy, nil policy allows everything.
+// returns TKEAuths without bindings skipped, adoptions of bindings to take over, and errors of rejected sources, key is SourceKey of source.
+func CheckAdoption(tkeAuths []*TKEAuth, unmanaged Unmanaged, policy *Policy) ([]*TKEAuth, Adoptions, map[string]error) {
+	ret := make([]*TKEAuth, 0)
+	adoptions := make(Adoptions)
+	rejected := make(map[string]error)
+
+	for _, tkeAuth := range tkeAuths {
+		adopt := tkeAuth.adoptPolicy()
+		roleRef := toRoleRef(tkeAuth.RoleKind, tkeAuth.RoleName)
+		skipped := sets.NewString()
+
+		for _, key := range tkeAuth.bindingKeys() {
+			existingRoleRef, ok := unmanaged[key]
+			if !ok {
+				continue
+			}
+
+			sourceKey := SourceKey(tkeAuth.Source)
+			switch adopt {
+			case AdoptPolicySkip:
+				klog.Warningf("%s already exists and is not managed by tke-auth, skipping binding of source %s\n", key, sourceKey)
+				skipped.Insert(key)
+			case AdoptPolicyOverwrite, AdoptPolicyMerge:
+				if existingRoleRef != roleRef {
+					rejected[sourceKey] = errors.Errorf("%s already exists with roleRef %s/%s, cannot be adopted since roleRef is immutable", key, existingRoleRef.Kind, existingRoleRef.Name)
+					continue
+				}
+
+				if err := policy.CheckAdopt(tkeAuth); err != nil {
+					rejected[sourceKey] = errors.Wrapf(err, "%s already exists and is not managed by tke-auth", key)
+					continue
+				}
+
+				// existing subjects are kept if any source of merged binding wants
+				if adoptions[key] != AdoptPolicyMerge {
+					adoptions[key] = adopt
+				}
+			default:
+				rejected[sourceKey] = errors.Errorf("%s already exists and is not managed by tke-auth, set adopt to one of %s to take it over", key, strings.Join(AdoptPolicies[1:], ", "))
+			}
+		}
+
+		if skipped.Len() == 0 {
+			ret = append(ret, tkeAuth)
+			continue
+		}
+
+		if !tkeAuth.IsNamespaced() {
+			continue
+		}
+
+		// RoleBindings of other namespaces are still created
+		namespaces := make([]string, 0)
+		for _, namespace := range tkeAuth.Namespaces {
+			if !skipped.Has("RoleBinding/" + namespace + "/" + tkeAuth.BindingName) {
+				namespaces = append(namespaces, namespace)
+			}
+		}
+
+		if len(namespaces) > 0 {
+			copied := *tkeAuth
+			copied.Namespaces = namespaces
+			ret = append(ret, &copied)
+		}
+	}
+
+	return ret, adoptions, rejected
+}
+
+// adoptMeta adds managed annotation to unmanaged binding, and records existing subjects if policy is AdoptPolicyMerge
+func adoptMeta(meta *v15.ObjectMeta, subjects []v14.Subject, policy string) {
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[AnnotationKeyManagedTKEAuthCRB] = AnnotationValueManagedTKEAuthCRB
+
+	if policy == AdoptPolicyMerge {
+		buf, _ := json.Marshal(subjects) // list of subjects is always marshalled
+		meta.Annotations[AnnotationKeyAdoptedSubjects] = string(buf)
+	}
+}
+
+// adoptedSubjects returns subjects of binding before adopted with AdoptPolicyMerge, false if binding is not adopted with AdoptPolicyMerge
+func adoptedSubjects(meta v15.ObjectMeta) ([]v14.Subject, bool) {
+	value, ok := meta.Annotations[AnnotationKeyAdoptedSubjects]
+	if !ok {
+		return nil, false
+	}
+
+	adopted := make([]v14.Subject, 0)
+	if err := json.Unmarshal([]byte(value), &adopted); err != nil {
+		klog.Warningf("cannot parse %s annotation of %s, ignoring. err: %s\n", AnnotationKeyAdoptedSubjects, meta.Name, err)
+		return nil, false
+	}
+
+	return adopted, true
+}
+
+// withAdoptedSubjects returns subjects with adopted subjects of binding added
+func withAdoptedSubjects(meta v15.ObjectMeta, subjects []v14.Subject) []v14.Subject {
+	adopted, ok := adoptedSubjects(meta)
+	if !ok {
+		return subjects
+	}
+
+	keys := sets.NewString()
+	for _, subject := range subjects {
+		keys.Insert(subjectKey(subject))
+	}
+
+	ret := append([]v14.Subject{}, subjects...)
+	for _, subject := range adopted {
+		if !keys.Has(subjectKey(subject)) {
+			keys.Insert(subjectKey(subject))
+			ret = append(ret, subject)
+		}
+	}
+
+	return ret
+}
+
+// Unmanaged returns roleRef of ClusterRoleBindings without managed annotation
+func (TKEAuthCRB *TKEAuthClusterRoleBindings) Unmanaged() (Unmanaged, error) {
+	TKEAuthCRB.waitUntilCacheSync()
+
+	CRBs, err := TKEAuthCRB.Lister.List(labels.NewSelector())
+	if err != nil {
+		return nil, err
+	}
+
+	unmanaged := make(Unmanaged)
+	for _, crb := range CRBs {
+		if _, ok := crb.Annotations[AnnotationKeyManagedTKEAuthCRB]; !ok {
+			unmanaged["ClusterRoleBinding/"+crb.Name] = crb.RoleRef
+		}
+	}
+
+	return unmanaged, nil
+}
+
+// Unmanaged returns roleRef of RoleBindings without managed annotation
+func (TKEAuthRB *TKEAuthRoleBindings) Unmanaged() (Unmanaged, error) {
+	TKEAuthRB.waitUntilCacheSync()
+
+	RBs, err := TKEAuthRB.Lister.List(labels.NewSelector())
+	if err != nil {
+		return nil, err
+	}
+
+	unmanaged := make(Unmanaged)
+	for _, rb := range RBs {
+		if _, ok := rb.Annotations[AnnotationKeyManagedTKEAuthCRB]; !ok {
+			unmanaged["RoleBinding/"+roleBindingKey(rb)] = rb.RoleRef
+		}
+	}
+
+	return unmanaged, nil
+}
+
+// getAdoptedClusterRoleBindings returns deep-copied unmanaged CRBs claimed and adopted, with managed annotation added
+func (TKEAuthCRB *TKEAuthClusterRoleBindings) getAdoptedClusterRoleBindings(claimed sets.String, adoptions Adoptions) ([]*v14.ClusterRoleBinding, error) {
+	ret := make([]*v14.ClusterRoleBinding, 0)
+	if len(adoptions) == 0 {
+		return ret, nil
+	}
+
+	CRBs, err := TKEAuthCRB.Lister.List(labels.NewSelector())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, crb := range CRBs {
+		policy, ok := adoptions["ClusterRoleBinding/"+crb.Name]
+		if _, managed := crb.Annotations[AnnotationKeyManagedTKEAuthCRB]; !ok || managed || !claimed.Has(crb.Name) {
+			continue
+		}
+
+		klog.Infof("adopting CRB %s, policy: %s\n", crb.Name, policy)
+		adopted := crb.DeepCopy()
+		adoptMeta(&adopted.ObjectMeta, adopted.Subjects, policy)
+		ret = append(ret, adopted)
+	}
+
+	return ret, nil
+}
+
+// getAdoptedRoleBindings returns deep-copied unmanaged RBs claimed and adopted, with managed annotation added
+func (TKEAuthRB *TKEAuthRoleBindings) getAdoptedRoleBindings(claimed sets.String, adoptions Adoptions) ([]*v14.RoleBinding, error) {
+	ret := make([]*v14.RoleBinding, 0)
+	if len(adoptions) == 0 {
+		return ret, nil
+	}
+
+	RBs, err := TKEAuthRB.Lister.List(labels.NewSelector())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rb := range RBs {
+		policy, ok := adoptions["RoleBinding/"+roleBindingKey(rb)]
+		if _, managed := rb.Annotations[AnnotationKeyManagedTKEAuthCRB]; !ok || managed || !claimed.Has(roleBindingKey(rb)) {
+			continue
+		}
+
+		klog.Infof("adopting RB %s, policy: %s\n", roleBindingKey(rb), policy)
+		adopted := rb.DeepCopy()
+		adoptMeta(&adopted.ObjectMeta, adopted.Subjects, policy)
+		ret = append(ret, adopted)
+	}
+
+	return ret, nil
+}
+
+// releaseAdoptedClusterRoleBindings returns deletions except CRBs adopted with AdoptPolicyMerge,
+// and deep-copied adopted CRBs restored to subjects before adopted, which are released instead of being deleted
+func releaseAdoptedClusterRoleBindings(deletions []*v14.ClusterRoleBinding) ([]*v14.ClusterRoleBinding, []*v14.ClusterRoleBinding) {
+	ret := make([]*v14.ClusterRoleBinding, 0)
+	releases := make([]*v14.ClusterRoleBinding, 0)
+
+	for _, crb := range deletions {
+		subjects, ok := adoptedSubjects(crb.ObjectMeta)
+		if !ok {
+			ret = append(ret, crb)
+			continue
+		}
+
+		released := crb.DeepCopy()
+		released.Subjects = subjects
+		releaseMeta(&released.ObjectMeta)
+		releases = append(releases, released)
+	}
+
+	return ret, releases
+}
+
+// releaseAdoptedRoleBindings returns deletions except RBs adopted with AdoptPolicyMerge,
+// and deep-copied adopted RBs restored to subjects before adopted, which are released instead of being deleted
+func releaseAdoptedRoleBindings(deletions []*v14.RoleBinding) ([]*v14.RoleBinding, []*v14.RoleBinding) {
+	ret := make([]*v14.RoleBinding, 0)
+	releases := make([]*v14.RoleBinding, 0)
+
+	for _, rb := range deletions {
+		subjects, ok := adoptedSubjects(rb.ObjectMeta)
+		if !ok {
+			ret = append(ret, rb)
+			continue
+		}
+
+		released := rb.DeepCopy()
+		released.Subjects = subjects
+		releaseMeta(&released.ObjectMeta)
+		releases = append(releases, released)
+	}
+
+	return ret, releases
+}
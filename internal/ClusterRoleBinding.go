@@ -7,12 +7,14 @@ import (
 	v14 "k8s.io/api/rbac/v1"
 	v15 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
 	v1 "k8s.io/client-go/informers/rbac/v1"
 	v13 "k8s.io/client-go/kubernetes/typed/rbac/v1"
 	v12 "k8s.io/client-go/listers/rbac/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 	"strings"
+	"time"
 )
 
 type TKEAuthClusterRoleBindings struct {
@@ -21,6 +23,8 @@ type TKEAuthClusterRoleBindings struct {
 	Synced   cache.InformerSynced
 
 	crbIface v13.ClusterRoleBindingInterface
+	// applied is CRBs written by controller, see Drift
+	applied *appliedBindings
 
 	stopCh <-chan struct{}
 }
@@ -28,6 +32,8 @@ type TKEAuthClusterRoleBindings struct {
 const (
 	AnnotationKeyManagedTKEAuthCRB   = "tke-auth/managed-by"
 	AnnotationValueManagedTKEAuthCRB = "tke-auth"
+	// AnnotationKeySource is key of source object which binding is created from, value is "Kind/namespace/name"
+	AnnotationKeySource = "tke-auth/source"
 )
 
 func NewTKEAuthClusterRoleBinding(informer v1.ClusterRoleBindingInformer, lister v12.ClusterRoleBindingLister, crbIface v13.ClusterRoleBindingInterface, stopCh <-chan struct{}) *TKEAuthClusterRoleBindings {
@@ -36,23 +42,108 @@ func NewTKEAuthClusterRoleBinding(informer v1.ClusterRoleBindingInformer, lister
 		Lister:   lister,
 		Synced:   informer.Informer().HasSynced,
 		crbIface: crbIface,
+		applied:  newAppliedBindings(),
 		stopCh:   stopCh,
 	}
 
 	return crb
 }
 
-func (TKEAuthCRB *TKEAuthClusterRoleBindings) UpsertClusterRoleBindings(newCRBs []*v14.ClusterRoleBinding) error {
+// ClusterRoleBindingPlan is changes of CRBs to apply newCRBs, see PlanClusterRoleBindings
+type ClusterRoleBindingPlan struct {
+	Additions []*v14.ClusterRoleBinding
+	Updates   []*v14.ClusterRoleBinding
+	Deletions []*v14.ClusterRoleBinding
+	// Recreations bind another role, they are deleted and created again since roleRef is immutable
+	Recreations []*v14.ClusterRoleBinding
+	// Releases are CRBs adopted with AdoptPolicyMerge and not claimed anymore, restored to subjects before adopted instead of being deleted
+	Releases []*v14.ClusterRoleBinding
+	// Managed is number of managed CRBs before plan is applied
+	Managed int
+
+	// old is CRBs to be changed by plan, key is name
+	old map[string]*v14.ClusterRoleBinding
+}
+
+// PlanClusterRoleBindings returns changes to apply newCRBs and delete managed CRBs not in newCRBs.
+// CRBs created from skipSources are kept untouched, unless newCRBs has CRB of same name.
+// expired subjects are still revoked from kept CRBs created only from expireSources.
+// unmanaged CRBs in adoptions are taken over instead of being created.
+func (TKEAuthCRB *TKEAuthClusterRoleBindings) PlanClusterRoleBindings(newCRBs []*v14.ClusterRoleBinding, skipSources sets.String, expireSources sets.String, adoptions Adoptions) (*ClusterRoleBindingPlan, error) {
 	TKEAuthCRB.waitUntilCacheSync()
 
-	oldCRBs, err := TKEAuthCRB.getClusterRoleBindings()
+	CRBs, err := TKEAuthCRB.getClusterRoleBindings()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	managed := len(CRBs)
+
+	claimed := sets.NewString()
+	for _, new := range newCRBs {
+		claimed.Insert(new.Name)
+	}
+
+	adopted, err := TKEAuthCRB.getAdoptedClusterRoleBindings(claimed, adoptions)
+	if err != nil {
+		return nil, err
+	}
+	CRBs = append(CRBs, adopted...)
+
+	// keep subjects of failed sources in merged CRB
+	for _, newCrb := range newCRBs {
+		for _, crb := range CRBs {
+			if crb.Name == newCrb.Name {
+				newCrb.Subjects = retainSubjectsOfSources(&newCrb.ObjectMeta, newCrb.Subjects, crb.ObjectMeta, crb.Subjects, skipSources)
+			}
+		}
+	}
+
+	oldCRBs := make([]*v14.ClusterRoleBinding, 0)
+	revocations := make([]*v14.ClusterRoleBinding, 0)
+	now := time.Now()
+	for _, crb := range CRBs {
+		// object claimed by another source is not skipped, the other source takes it over
+		if isCreatedFromSources(crb.ObjectMeta, skipSources) && !claimed.Has(crb.Name) {
+			klog.V(log.VerboseLevel).Infof("skipping CRB %s, source %s is failed to sync.\n", crb.Name, crb.Annotations[AnnotationKeySource])
+
+			subjects, expiry := withoutExpiredSubjects(crb.ObjectMeta, crb.Subjects, now)
+			if isCreatedOnlyFromSources(crb.ObjectMeta, expireSources) && len(subjects) < len(crb.Subjects) {
+				klog.Infof("revoking expired subjects of skipped CRB %s\n", crb.Name)
+				revoked := crb.DeepCopy()
+				revoked.Subjects = subjects
+				setSubjectExpiry(&revoked.ObjectMeta, expiry)
+				revocations = append(revocations, revoked)
+			}
+			continue
+		}
+
+		oldCRBs = append(oldCRBs, crb)
+	}
+
+	updates, recreations := splitRoleRefChanges(getUpdates(newCRBs, oldCRBs), oldCRBs)
+	updates = append(updates, revocations...)
+	deletions, releases := releaseAdoptedClusterRoleBindings(difference(oldCRBs, newCRBs))
+	plan := &ClusterRoleBindingPlan{
+		Additions:   difference(newCRBs, oldCRBs),
+		Updates:     updates,
+		Deletions:   deletions,
+		Recreations: recreations,
+		Releases:    releases,
+		Managed:     managed,
+		old:         make(map[string]*v14.ClusterRoleBinding),
+	}
+	for _, crb := range CRBs {
+		plan.old[crb.Name] = crb
 	}
 
-	deletions := difference(oldCRBs, newCRBs)
-	additions := difference(newCRBs, oldCRBs)
-	updates := getUpdates(newCRBs, oldCRBs)
+	return plan, nil
+}
+
+// ApplyClusterRoleBindings applies changes of plan
+func (TKEAuthCRB *TKEAuthClusterRoleBindings) ApplyClusterRoleBindings(plan *ClusterRoleBindingPlan) error {
+	deletions := append(plan.Deletions, plan.Recreations...)
+	additions := append(plan.Additions, plan.Recreations...)
+	updates := plan.Updates
 	klog.Infof("CRB changed. add: %d, update: %d, delete: %d\n", len(additions), len(updates), len(deletions))
 
 	// print add
@@ -64,10 +155,13 @@ func (TKEAuthCRB *TKEAuthClusterRoleBindings) UpsertClusterRoleBindings(newCRBs
 	// print delete
 	klog.Infof("deleted CRBs: %s\n", strings.Join(funk.Map(deletions, func(crb *v14.ClusterRoleBinding) string { return crb.Name }).([]string), ", "))
 
+	// print release
+	klog.Infof("released CRBs: %s\n", strings.Join(funk.Map(plan.Releases, func(crb *v14.ClusterRoleBinding) string { return crb.Name }).([]string), ", "))
+
 	// total
 	klog.Infof("total CRBs: %d\n", len(additions)+len(updates)+len(deletions))
 
-	err = TKEAuthCRB.deleteCRBs(deletions)
+	err := TKEAuthCRB.deleteCRBs(deletions)
 	if err != nil {
 		return err
 	}
@@ -79,6 +173,10 @@ func (TKEAuthCRB *TKEAuthClusterRoleBindings) UpsertClusterRoleBindings(newCRBs
 	if err != nil {
 		return err
 	}
+	err = TKEAuthCRB.updateCRBs(plan.Releases)
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -122,8 +220,9 @@ func getUpdates(new, old []*v14.ClusterRoleBinding) []*v14.ClusterRoleBinding {
 		if ok {
 			oldCrbCopy := oldCrb.DeepCopy()
 			newCrbCopy := newCrb.DeepCopy()
-			oldCrbCopy.Subjects = newCrbCopy.Subjects
+			oldCrbCopy.Subjects = withAdoptedSubjects(oldCrbCopy.ObjectMeta, newCrbCopy.Subjects)
 			oldCrbCopy.RoleRef = newCrbCopy.RoleRef
+			copySourceAnnotation(&oldCrbCopy.ObjectMeta, newCrbCopy.ObjectMeta)
 			updates = append(updates, oldCrbCopy)
 		}
 	}
@@ -168,10 +267,12 @@ func (TKEAuthCRB *TKEAuthClusterRoleBindings) addCRBs(CRBs []*v14.ClusterRoleBin
 	crbIface := TKEAuthCRB.crbIface
 	for _, crb := range CRBs {
 		crb.Annotations[AnnotationKeyManagedTKEAuthCRB] = AnnotationValueManagedTKEAuthCRB
-		_, err := crbIface.Create(context.TODO(), crb, v15.CreateOptions{})
+		TKEAuthCRB.applied.set(crb.Name, crb.Subjects, crb.RoleRef)
+		created, err := crbIface.Create(context.TODO(), crb, v15.CreateOptions{})
 		if err != nil {
 			return err
 		}
+		TKEAuthCRB.applied.written(crb.Name, created.ObjectMeta)
 	}
 
 	return nil
@@ -180,10 +281,12 @@ func (TKEAuthCRB *TKEAuthClusterRoleBindings) addCRBs(CRBs []*v14.ClusterRoleBin
 func (TKEAuthCRB *TKEAuthClusterRoleBindings) updateCRBs(CRBs []*v14.ClusterRoleBinding) error {
 	crbIface := TKEAuthCRB.crbIface
 	for _, crb := range CRBs {
-		_, err := crbIface.Update(context.TODO(), crb, v15.UpdateOptions{})
+		TKEAuthCRB.applied.set(crb.Name, crb.Subjects, crb.RoleRef)
+		updated, err := crbIface.Update(context.TODO(), crb, v15.UpdateOptions{})
 		if err != nil {
 			return err
 		}
+		TKEAuthCRB.applied.written(crb.Name, updated.ObjectMeta)
 	}
 
 	return nil
@@ -193,6 +296,7 @@ func (TKEAuthCRB *TKEAuthClusterRoleBindings) deleteCRBs(CRBs []*v14.ClusterRole
 	crbIface := TKEAuthCRB.crbIface
 	for _, crb := range CRBs {
 		checkClusterRoleBindingIsManaged(crb)
+		TKEAuthCRB.applied.remove(crb.Name)
 		err := crbIface.Delete(context.TODO(), crb.Name, v15.DeleteOptions{})
 		if err != nil {
 			return err
@@ -202,6 +306,26 @@ func (TKEAuthCRB *TKEAuthClusterRoleBindings) deleteCRBs(CRBs []*v14.ClusterRole
 	return nil
 }
 
+// isCreatedFromSources returns true if any source in source annotation of object is in sources
+func isCreatedFromSources(meta v15.ObjectMeta, sources sets.String) bool {
+	return sources.HasAny(SourcesOf(meta)...)
+}
+
+// copySourceAnnotation sets source, source-uid, subject-sources and subject-expiry annotation of src to dst, used when updating existing object
+func copySourceAnnotation(dst *v15.ObjectMeta, src v15.ObjectMeta) {
+	if dst.Annotations == nil {
+		dst.Annotations = map[string]string{}
+	}
+
+	for _, key := range []string{AnnotationKeySource, AnnotationKeySourceUID, AnnotationKeySubjectSources, AnnotationKeySubjectExpiry} {
+		if value, ok := src.Annotations[key]; ok {
+			dst.Annotations[key] = value
+		} else if key == AnnotationKeySubjectSources || key == AnnotationKeySubjectExpiry {
+			delete(dst.Annotations, key)
+		}
+	}
+}
+
 // check clusterRoleBinding has managed annotation, throws panic if not.
 func checkClusterRoleBindingIsManaged(crb *v14.ClusterRoleBinding) {
 	if _, ok := crb.Annotations[AnnotationKeyManagedTKEAuthCRB]; !ok {
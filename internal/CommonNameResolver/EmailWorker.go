@@ -54,8 +54,10 @@ func (worker *Worker_Email) ResolveCommonNames(users []*internal.User) error {
 		}
 
 		// convert user's subAccountId to CommonName
+		// value is left as original if conversion is failed
 		for j := 0; j < length; j++ {
 			(*users[start+j]).Value = CNs[j]
+			(*users[start+j]).Resolved = CNs[j] != names[j]
 		}
 	}
 
@@ -3,6 +3,7 @@ package CommonNameResolver
 import (
 	"example.com/tke-auth-controller/internal"
 	"github.com/pkg/errors"
+	"sort"
 	"sync"
 )
 
@@ -32,22 +33,36 @@ func (resolver *CommonNameResolver) AddWorker(worker CommonNameResolveWorker) {
 	resolver.resolveWorkers[valueType] = worker
 }
 
+// ValueTypes returns value types of users which can be resolved by added workers
+func (resolver *CommonNameResolver) ValueTypes() []string {
+	valueTypes := make([]string, 0, len(resolver.resolveWorkers))
+	for valueType := range resolver.resolveWorkers {
+		valueTypes = append(valueTypes, valueType)
+	}
+	sort.Strings(valueTypes)
+
+	return valueTypes
+}
+
 func (resolver *CommonNameResolver) ResolveCommonNames(users []internal.User) error {
 	UsersSortedByType := sortUsersByType(users)
 	errs := make([]error, 0)
+	errsLock := sync.Mutex{}
 	waitGroup := sync.WaitGroup{}
 
 	for valueType, users := range UsersSortedByType {
 		worker, ok := resolver.resolveWorkers[valueType]
 		if ok {
 			waitGroup.Add(1)
-			go func() {
+			go func(worker CommonNameResolveWorker, users []*internal.User) {
 				defer waitGroup.Done()
 				err := worker.ResolveCommonNames(users)
 				if err != nil {
+					errsLock.Lock()
 					errs = append(errs, err)
+					errsLock.Unlock()
 				}
-			}()
+			}(worker, users)
 		}
 	}
 
@@ -65,6 +80,11 @@ func sortUsersByType(users []internal.User) map[string][]*internal.User {
 
 	for i := 0; i < len(users); i++ {
 		user := &users[i]
+		if !user.NeedsResolve() { // Group, ServiceAccount is used as-is
+			user.Resolved = true
+			continue
+		}
+
 		if _, ok := ret[user.ValueType]; !ok {
 			ret[user.ValueType] = make([]*internal.User, 0)
 		}
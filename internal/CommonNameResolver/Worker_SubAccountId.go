@@ -45,8 +45,10 @@ func (worker *Worker_SubAccountId) ResolveCommonNames(users []*internal.User) er
 		}
 
 		// convert user's subAccountId to CommonName
+		// value is left as original if conversion is failed
 		for j := 0; j < length; j++ {
 			(*users[start+j]).Value = CNs[j]
+			(*users[start+j]).Resolved = CNs[j] != subAccountIds[j]
 		}
 	}
 
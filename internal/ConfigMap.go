@@ -1,20 +1,29 @@
 package internal
 
 import (
+	"context"
+	"encoding/json"
 	"example.com/tke-auth-controller/log"
+	"github.com/pkg/errors"
 	"gopkg.in/yaml.v3"
 	v12 "k8s.io/api/core/v1"
+	v13 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
 	v1 "k8s.io/client-go/informers/core/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	listersv1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
+	"strings"
 )
 
 const (
 	DataKeyBindingName            = "bindingName"
 	DataKeyRoleName               = "roleName"
+	DataKeyRoleKind               = "roleKind"
 	DataKeyUsers                  = "users"
+	DataKeyBindings               = "bindings"
 	AnnotationKeyTKEAuthConfigMap = "tke-auth/binding"
 	syncRetryCountLimit           = 5
 )
@@ -24,33 +33,58 @@ type TKEAuthConfigMaps struct {
 	Lister   listersv1.ConfigMapLister
 	Synced   cache.InformerSynced
 
+	cmGetter corev1.ConfigMapsGetter
+
 	stopCh <-chan struct{}
 }
 
-func NewTKEAuthConfigMaps(informer v1.ConfigMapInformer, lister listersv1.ConfigMapLister) *TKEAuthConfigMaps {
+func NewTKEAuthConfigMaps(informer v1.ConfigMapInformer, lister listersv1.ConfigMapLister, cmGetter corev1.ConfigMapsGetter) *TKEAuthConfigMaps {
 	authCfg := TKEAuthConfigMaps{
 		Informer: informer,
 		Lister:   lister,
 		Synced:   informer.Informer().HasSynced,
+		cmGetter: cmGetter,
 	}
 
 	return &authCfg
 }
 
+// ConfigMapReference returns reference of configMap, used as source of TKEAuth
+func ConfigMapReference(cfgMap *v12.ConfigMap) v12.ObjectReference {
+	return v12.ObjectReference{
+		Kind:            "ConfigMap",
+		APIVersion:      "v1",
+		Namespace:       cfgMap.Namespace,
+		Name:            cfgMap.Name,
+		UID:             cfgMap.UID,
+		ResourceVersion: cfgMap.ResourceVersion,
+	}
+}
+
 func ToTKEAuth(cfgMap *v12.ConfigMap) (*TKEAuth, error) {
-	bindingName := cfgMap.Data[DataKeyBindingName]
-	roleName := cfgMap.Data[DataKeyRoleName]
+	return dataToTKEAuth(cfgMap.Data, ConfigMapReference(cfgMap), cfgMap.CreationTimestamp)
+}
+
+// dataToTKEAuth returns TKEAuth from data of source object, shared by configMap and secret
+func dataToTKEAuth(data map[string]string, source v12.ObjectReference, creationTimestamp v13.Time) (*TKEAuth, error) {
+	bindingName := data[DataKeyBindingName]
+	roleName := data[DataKeyRoleName]
+	roleKind := data[DataKeyRoleKind]
 
 	type Users struct {
 		Users []string `yaml:"users"`
 	}
 
-	usersStr := cfgMap.Data[DataKeyUsers]
+	usersStr := data[DataKeyUsers]
 	tkeAuth := &TKEAuth{
 		DefaultUserValueType: "",
 		BindingName:          bindingName,
 		RoleName:             roleName,
+		RoleKind:             roleKind,
 		Users:                nil,
+		Source:               source,
+
+		SourceCreationTimestamp: creationTimestamp,
 	}
 
 	err := yaml.Unmarshal([]byte(usersStr), tkeAuth)
@@ -58,19 +92,92 @@ func ToTKEAuth(cfgMap *v12.ConfigMap) (*TKEAuth, error) {
 		return nil, err
 	}
 
-	// set defaultValue if user.valueType is not provided
-	for i := 0; i < len(tkeAuth.Users); i++ {
-		user := &tkeAuth.Users[i]
+	// set defaultValue if user.kind or user.valueType is not provided
+	tkeAuth.setDefaults()
+
+	return tkeAuth, nil
+}
+
+// BindingEntry is an item of "bindings" list in configMap, creates one more binding from a configMap.
+type BindingEntry struct {
+	BindingName string   `yaml:"bindingName"`
+	RoleName    string   `yaml:"roleName"`
+	RoleKind    string   `yaml:"roleKind"`
+	Namespaces  []string `yaml:"namespaces"`
+	// Users is subset of users by value. every user in configMap is bound if empty
+	Users             []string          `yaml:"users"`
+	Rules             []Rule            `yaml:"rules"`
+	AggregationLabels map[string]string `yaml:"aggregationLabels"`
+	Merge             bool              `yaml:"merge"`
+	Adopt             string            `yaml:"adopt"`
+	NotBefore         string            `yaml:"notBefore"`
+	ExpiresAt         string            `yaml:"expiresAt"`
+	Schedule          *Schedule         `yaml:"schedule"`
+}
+
+// ToTKEAuths returns TKEAuth of "bindingName" and each item of "bindings" list in configMap.
+// errors are returned per binding entry, valid entries are returned along with errors of other entries so that every entry can be validated, eg: by webhook.
+// sync fails whole source if any error is returned, and keeps existing bindings of the source until every entry is fixed.
+func ToTKEAuths(cfgMap *v12.ConfigMap) ([]*TKEAuth, []error) {
+	return dataToTKEAuths(cfgMap.Data, ConfigMapReference(cfgMap), cfgMap.CreationTimestamp)
+}
+
+// dataToTKEAuths returns TKEAuths from data of source object, shared by configMap and secret
+func dataToTKEAuths(data map[string]string, source v12.ObjectReference, creationTimestamp v13.Time) ([]*TKEAuth, []error) {
+	// eg: "configMap: namespace/name"
+	sourceName := strings.ToLower(source.Kind[:1]) + source.Kind[1:] + ": " + source.Namespace + "/" + source.Name
+
+	base, err := dataToTKEAuth(data, source, creationTimestamp)
+	if err != nil {
+		return nil, []error{errors.Wrapf(err, "%s, cannot parse users", sourceName)}
+	}
+
+	tkeAuths := make([]*TKEAuth, 0)
+	errs := make([]error, 0)
+	bindingNames := make(map[string]bool)
+
+	if base.BindingName != "" {
+		tkeAuths = append(tkeAuths, base)
+		bindingNames[base.BindingName] = true
+	}
+
+	bindingsStr, ok := data[DataKeyBindings]
+	if !ok {
+		return tkeAuths, errs
+	}
+
+	entries := make([]BindingEntry, 0)
+	err = yaml.Unmarshal([]byte(bindingsStr), &entries)
+	if err != nil {
+		return tkeAuths, append(errs, errors.Wrapf(err, "%s, cannot parse bindings", sourceName))
+	}
 
-		if user.ValueType == "" {
-			user.ValueType = tkeAuth.DefaultUserValueType
+	for i, entry := range entries {
+		if entry.BindingName == "" || entry.RoleName == "" {
+			errs = append(errs, errors.Errorf("%s, bindings[%d]: bindingName and roleName are required.", sourceName, i))
+			continue
 		}
+
+		if bindingNames[entry.BindingName] {
+			errs = append(errs, errors.Errorf("%s, bindings[%d]: bindingName %s is duplicated.", sourceName, i, entry.BindingName))
+			continue
+		}
+
+		tkeAuth, err := base.withBindingEntry(entry)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "%s, bindings[%d]", sourceName, i))
+			continue
+		}
+
+		tkeAuths = append(tkeAuths, tkeAuth)
+		bindingNames[entry.BindingName] = true
 	}
 
-	return tkeAuth, nil
+	return tkeAuths, errs
 }
 
-// GetTKEAuthConfigMaps returns all deep-copied configMap with "tke-auth/binding" annotation attached
+// GetTKEAuthConfigMaps returns all deep-copied configMap with "tke-auth/binding" annotation attached,
+// and configMap with finalizer of controller whose annotation is removed. see IsReleased
 func (cfg *TKEAuthConfigMaps) GetTKEAuthConfigMaps() ([]*v12.ConfigMap, error) {
 	cfg.waitUntilCacheSync()
 
@@ -82,7 +189,7 @@ func (cfg *TKEAuthConfigMaps) GetTKEAuthConfigMaps() ([]*v12.ConfigMap, error) {
 	ret := make([]*v12.ConfigMap, 0)
 
 	for _, cfgMap := range cfgMaps {
-		if _, ok := cfgMap.Annotations[AnnotationKeyTKEAuthConfigMap]; ok {
+		if _, ok := cfgMap.Annotations[AnnotationKeyTKEAuthConfigMap]; ok || HasFinalizer(cfgMap.ObjectMeta) {
 			ret = append(ret, cfgMap.DeepCopy())
 		}
 	}
@@ -90,6 +197,28 @@ func (cfg *TKEAuthConfigMaps) GetTKEAuthConfigMaps() ([]*v12.ConfigMap, error) {
 	return ret, nil
 }
 
+// UpdateStatus patches status annotations of sync to configMap, resourceVersion of cfgMap is updated to patched one
+func (cfg *TKEAuthConfigMaps) UpdateStatus(cfgMap *v12.ConfigMap, status *SyncStatus) error {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": status.toAnnotations(),
+		},
+	}
+
+	buf, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+
+	patched, err := cfg.cmGetter.ConfigMaps(cfgMap.Namespace).Patch(context.TODO(), cfgMap.Name, types.MergePatchType, buf, v13.PatchOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "cannot update status of configMap %s/%s", cfgMap.Namespace, cfgMap.Name)
+	}
+	cfgMap.ResourceVersion = patched.ResourceVersion
+
+	return nil
+}
+
 // wait until cache Synced
 func (cfg *TKEAuthConfigMaps) waitUntilCacheSync() {
 	retryCount := 0
@@ -0,0 +1,163 @@
+package internal
+
+import (
+	v12 "k8s.io/api/core/v1"
+	v15 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var configMapTestSource = v12.ObjectReference{Kind: "ConfigMap", Namespace: "team-a", Name: "binding"}
+
+const configMapTestUsers = `defaultUserValueType: subAccountId
+adopt: merge
+users:
+  - value: "100"
+  - type: email
+    value: a@pubg.com
+  - group: platform-team
+`
+
+func userValues(users []User) []string {
+	values := make([]string, 0)
+	for _, user := range users {
+		if user.IsGroupRef() {
+			values = append(values, "group/"+user.Group)
+		} else {
+			values = append(values, user.ValueType+"/"+user.Value)
+		}
+	}
+
+	return values
+}
+
+func TestDataToTKEAuths(t *testing.T) {
+	data := map[string]string{
+		DataKeyBindingName: "team-a-admin",
+		DataKeyRoleName:    "admin",
+		DataKeyUsers:       configMapTestUsers,
+		DataKeyBindings: `- bindingName: team-a-view
+  roleName: view
+- bindingName: team-a-pods
+  roleName: pod-reader
+  roleKind: Role
+  namespaces: ["team-a"]
+  adopt: skip
+  users:
+    - a@pubg.com
+    - platform-team
+`,
+	}
+
+	tkeAuths, errs := dataToTKEAuths(data, configMapTestSource, v15.Time{})
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(tkeAuths) != 3 {
+		t.Fatalf("expected 3 bindings, got %d", len(tkeAuths))
+	}
+
+	base, view, pods := tkeAuths[0], tkeAuths[1], tkeAuths[2]
+
+	if base.BindingName != "team-a-admin" || base.RoleName != "admin" || base.RoleKind != "ClusterRole" {
+		t.Errorf("unexpected base binding: %s, %s/%s", base.BindingName, base.RoleKind, base.RoleName)
+	}
+
+	allUsers := []string{"subAccountId/100", "email/a@pubg.com", "group/platform-team"}
+	if got := userValues(base.Users); !reflect.DeepEqual(got, allUsers) {
+		t.Errorf("users of base binding = %v, want %v", got, allUsers)
+	}
+
+	if got := userValues(view.Users); view.RoleKind != "ClusterRole" || view.Adopt != AdoptPolicyMerge || !reflect.DeepEqual(got, allUsers) {
+		t.Errorf("entry without users should inherit every user, roleKind and adopt of base. users: %v, roleKind: %s, adopt: %s", got, view.RoleKind, view.Adopt)
+	}
+
+	if got, want := userValues(pods.Users), []string{"email/a@pubg.com", "group/platform-team"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("users of entry = %v, want %v", got, want)
+	}
+	if pods.RoleKind != "Role" || pods.Adopt != AdoptPolicySkip || !reflect.DeepEqual(pods.Namespaces, []string{"team-a"}) {
+		t.Errorf("unexpected entry: roleKind: %s, adopt: %s, namespaces: %v", pods.RoleKind, pods.Adopt, pods.Namespaces)
+	}
+
+	for _, tkeAuth := range tkeAuths {
+		if tkeAuth.Source != configMapTestSource {
+			t.Errorf("source of %s = %v, want %v", tkeAuth.BindingName, tkeAuth.Source, configMapTestSource)
+		}
+	}
+}
+
+func TestDataToTKEAuthsErrors(t *testing.T) {
+	tests := []struct {
+		name         string
+		bindingName  string
+		users        string
+		bindings     string
+		wantBindings []string
+		wantErrs     []string
+	}{
+		{
+			name:         "bindings only",
+			users:        configMapTestUsers,
+			bindings:     "- bindingName: a\n  roleName: view\n",
+			wantBindings: []string{"a"},
+			wantErrs:     []string{},
+		},
+		{
+			name:         "invalid users fails every binding",
+			bindingName:  "base",
+			users:        "users: [",
+			bindings:     "- bindingName: a\n  roleName: view\n",
+			wantBindings: []string{},
+			wantErrs:     []string{"cannot parse users"},
+		},
+		{
+			name:         "invalid bindings keeps base binding",
+			bindingName:  "base",
+			users:        configMapTestUsers,
+			bindings:     "- bindingName: [",
+			wantBindings: []string{"base"},
+			wantErrs:     []string{"cannot parse bindings"},
+		},
+		{
+			name:         "invalid entries are skipped, other entries are kept",
+			bindingName:  "base",
+			users:        configMapTestUsers,
+			bindings:     "- bindingName: a\n- bindingName: base\n  roleName: view\n- bindingName: b\n  roleName: view\n  users: [unknown]\n- bindingName: c\n  roleName: view\n",
+			wantBindings: []string{"base", "c"},
+			wantErrs:     []string{"bindings[0]: bindingName and roleName are required", "bindings[1]: bindingName base is duplicated", "bindings[2]: user unknown is not in users"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := map[string]string{
+				DataKeyRoleName: "admin",
+				DataKeyUsers:    tt.users,
+				DataKeyBindings: tt.bindings,
+			}
+			if tt.bindingName != "" {
+				data[DataKeyBindingName] = tt.bindingName
+			}
+
+			tkeAuths, errs := dataToTKEAuths(data, configMapTestSource, v15.Time{})
+
+			names := make([]string, 0)
+			for _, tkeAuth := range tkeAuths {
+				names = append(names, tkeAuth.BindingName)
+			}
+			if !reflect.DeepEqual(names, tt.wantBindings) {
+				t.Errorf("bindings = %v, want %v", names, tt.wantBindings)
+			}
+
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("errors = %v, want %d errors", errs, len(tt.wantErrs))
+			}
+			for i, err := range errs {
+				if !strings.Contains(err.Error(), tt.wantErrs[i]) || !strings.Contains(err.Error(), "configMap: team-a/binding") {
+					t.Errorf("errors[%d] = %s, want to contain %q and source", i, err, tt.wantErrs[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package internal
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sort"
+	"strings"
+)
+
+const (
+	// ConflictPolicyReject rejects every source of conflicting binding.
+	// sources enabled merge with same role are not conflicts regardless of policy
+	ConflictPolicyReject = "reject"
+	// ConflictPolicyFirstCreated accepts the source created first, rejects the others
+	ConflictPolicyFirstCreated = "firstCreated"
+)
+
+// ConflictPolicies is list of valid conflict policies
+var ConflictPolicies = []string{ConflictPolicyReject, ConflictPolicyFirstCreated}
+
+// conflictKeys returns keys of objects created from TKEAuth. TKEAuths of different sources conflict if they share a key.
+func (t *TKEAuth) conflictKeys() []string {
+	keys := make([]string, 0)
+
+	if t.IsNamespaced() {
+		for _, namespace := range t.Namespaces {
+			keys = append(keys, "RoleBinding/"+namespace+"/"+t.BindingName)
+		}
+	} else {
+		keys = append(keys, "ClusterRoleBinding/"+t.BindingName)
+	}
+
+	if t.HasRules() {
+		keys = append(keys, "ClusterRole/"+t.RoleName)
+	}
+
+	return keys
+}
+
+// DetectConflicts finds objects claimed by TKEAuths of multiple sources, and decides rejected sources by policy.
+// returns errors of rejected sources, key is SourceKey of source.
+func DetectConflicts(tkeAuths []*TKEAuth, policy string) map[string]error {
+	sourcesByKey := make(map[string][]*TKEAuth)
+
+	for _, tkeAuth := range tkeAuths {
+		for _, key := range tkeAuth.conflictKeys() {
+			sourcesByKey[key] = appendIfNewSource(sourcesByKey[key], tkeAuth)
+		}
+	}
+
+	// sort keys to get same result regardless of order of tkeAuths
+	keys := make([]string, 0)
+	for key := range sourcesByKey {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rejected := make(map[string]error)
+	for _, key := range keys {
+		claimers := sourcesByKey[key]
+		if len(claimers) < 2 || canMerge(key, claimers) {
+			continue
+		}
+
+		sort.SliceStable(claimers, func(i, j int) bool {
+			a, b := claimers[i], claimers[j]
+			if !a.SourceCreationTimestamp.Equal(&b.SourceCreationTimestamp) {
+				return a.SourceCreationTimestamp.Before(&b.SourceCreationTimestamp)
+			}
+			return SourceKey(a.Source) < SourceKey(b.Source)
+		})
+
+		sourceKeys := make([]string, 0)
+		for _, claimer := range claimers {
+			sourceKeys = append(sourceKeys, SourceKey(claimer.Source))
+		}
+
+		losers := claimers
+		if policy == ConflictPolicyFirstCreated {
+			losers = claimers[1:]
+		}
+
+		for _, loser := range losers {
+			sourceKey := SourceKey(loser.Source)
+			if _, ok := rejected[sourceKey]; ok { // report first conflict only
+				continue
+			}
+
+			rejected[sourceKey] = errors.Errorf("%s is claimed by multiple sources: %s, rejected by conflict policy %s", key, strings.Join(sourceKeys, ", "), policy)
+		}
+	}
+
+	return rejected
+}
+
+// canMerge returns true if every claimer of binding enabled merge and binds same role. ClusterRole from rules cannot be merged.
+func canMerge(key string, claimers []*TKEAuth) bool {
+	if strings.HasPrefix(key, "ClusterRole/") {
+		return false
+	}
+
+	for _, claimer := range claimers {
+		if !claimer.Merge || claimer.RoleKind != claimers[0].RoleKind || claimer.RoleName != claimers[0].RoleName {
+			return false
+		}
+	}
+
+	return true
+}
+
+// appendIfNewSource appends tkeAuth to claimers if source of tkeAuth is not in claimers
+func appendIfNewSource(claimers []*TKEAuth, tkeAuth *TKEAuth) []*TKEAuth {
+	sources := sets.NewString()
+	for _, claimer := range claimers {
+		sources.Insert(SourceKey(claimer.Source))
+	}
+
+	if sources.Has(SourceKey(tkeAuth.Source)) {
+		return claimers
+	}
+
+	return append(claimers, tkeAuth)
+}
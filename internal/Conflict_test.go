@@ -0,0 +1,135 @@
+package internal
+
+import (
+	v12 "k8s.io/api/core/v1"
+	v15 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"testing"
+	"time"
+)
+
+// conflictTestTKEAuth returns ClusterRoleBinding of "view" from configMap in namespace, created at minute
+func conflictTestTKEAuth(namespace string, bindingName string, minute int) *TKEAuth {
+	return &TKEAuth{
+		BindingName:             bindingName,
+		RoleKind:                "ClusterRole",
+		RoleName:                "view",
+		Source:                  v12.ObjectReference{Kind: "ConfigMap", Namespace: namespace, Name: "binding"},
+		SourceCreationTimestamp: v15.NewTime(time.Date(2024, 1, 1, 0, minute, 0, 0, time.UTC)),
+	}
+}
+
+func TestDetectConflicts(t *testing.T) {
+	withMerge := func(tkeAuth *TKEAuth) *TKEAuth {
+		tkeAuth.Merge = true
+		return tkeAuth
+	}
+
+	tests := []struct {
+		name         string
+		tkeAuths     func() []*TKEAuth
+		policy       string
+		wantRejected []string
+	}{
+		{
+			name: "different bindings do not conflict",
+			tkeAuths: func() []*TKEAuth {
+				return []*TKEAuth{conflictTestTKEAuth("team-a", "a", 0), conflictTestTKEAuth("team-b", "b", 1)}
+			},
+			policy:       ConflictPolicyReject,
+			wantRejected: []string{},
+		},
+		{
+			name: "reject rejects every claimer",
+			tkeAuths: func() []*TKEAuth {
+				return []*TKEAuth{conflictTestTKEAuth("team-a", "shared", 0), conflictTestTKEAuth("team-b", "shared", 1)}
+			},
+			policy:       ConflictPolicyReject,
+			wantRejected: []string{"ConfigMap/team-a/binding", "ConfigMap/team-b/binding"},
+		},
+		{
+			name: "firstCreated accepts source created first regardless of order",
+			tkeAuths: func() []*TKEAuth {
+				return []*TKEAuth{conflictTestTKEAuth("team-b", "shared", 1), conflictTestTKEAuth("team-c", "shared", 2), conflictTestTKEAuth("team-a", "shared", 0)}
+			},
+			policy:       ConflictPolicyFirstCreated,
+			wantRejected: []string{"ConfigMap/team-b/binding", "ConfigMap/team-c/binding"},
+		},
+		{
+			name: "firstCreated breaks tie by source key",
+			tkeAuths: func() []*TKEAuth {
+				return []*TKEAuth{conflictTestTKEAuth("team-b", "shared", 0), conflictTestTKEAuth("team-a", "shared", 0)}
+			},
+			policy:       ConflictPolicyFirstCreated,
+			wantRejected: []string{"ConfigMap/team-b/binding"},
+		},
+		{
+			name: "multiple bindings of same source do not conflict",
+			tkeAuths: func() []*TKEAuth {
+				return []*TKEAuth{conflictTestTKEAuth("team-a", "shared", 0), conflictTestTKEAuth("team-a", "shared", 0)}
+			},
+			policy:       ConflictPolicyReject,
+			wantRejected: []string{},
+		},
+		{
+			name: "RoleBindings conflict only in same namespace",
+			tkeAuths: func() []*TKEAuth {
+				a, b, c := conflictTestTKEAuth("team-a", "shared", 0), conflictTestTKEAuth("team-b", "shared", 1), conflictTestTKEAuth("team-c", "shared", 2)
+				a.Namespaces = []string{"ns-1", "ns-2"}
+				b.Namespaces = []string{"ns-2"}
+				c.Namespaces = []string{"ns-3"}
+				return []*TKEAuth{a, b, c}
+			},
+			policy:       ConflictPolicyReject,
+			wantRejected: []string{"ConfigMap/team-a/binding", "ConfigMap/team-b/binding"},
+		},
+		{
+			name: "merge with same role is not a conflict",
+			tkeAuths: func() []*TKEAuth {
+				return []*TKEAuth{withMerge(conflictTestTKEAuth("team-a", "shared", 0)), withMerge(conflictTestTKEAuth("team-b", "shared", 1))}
+			},
+			policy:       ConflictPolicyReject,
+			wantRejected: []string{},
+		},
+		{
+			name: "merge requires every claimer to enable merge",
+			tkeAuths: func() []*TKEAuth {
+				return []*TKEAuth{withMerge(conflictTestTKEAuth("team-a", "shared", 0)), conflictTestTKEAuth("team-b", "shared", 1)}
+			},
+			policy:       ConflictPolicyReject,
+			wantRejected: []string{"ConfigMap/team-a/binding", "ConfigMap/team-b/binding"},
+		},
+		{
+			name: "merge with different role is a conflict",
+			tkeAuths: func() []*TKEAuth {
+				b := withMerge(conflictTestTKEAuth("team-b", "shared", 1))
+				b.RoleName = "edit"
+				return []*TKEAuth{withMerge(conflictTestTKEAuth("team-a", "shared", 0)), b}
+			},
+			policy:       ConflictPolicyFirstCreated,
+			wantRejected: []string{"ConfigMap/team-b/binding"},
+		},
+		{
+			name: "ClusterRole from rules cannot be merged",
+			tkeAuths: func() []*TKEAuth {
+				a, b := withMerge(conflictTestTKEAuth("team-a", "a", 0)), withMerge(conflictTestTKEAuth("team-b", "b", 1))
+				a.RoleName, b.RoleName = "custom", "custom"
+				a.Rules = []Rule{{Verbs: []string{"get"}, Resources: []string{"pods"}}}
+				b.Rules = a.Rules
+				return []*TKEAuth{a, b}
+			},
+			policy:       ConflictPolicyReject,
+			wantRejected: []string{"ConfigMap/team-a/binding", "ConfigMap/team-b/binding"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rejected := DetectConflicts(tt.tkeAuths(), tt.policy)
+
+			if got, want := sets.StringKeySet(rejected), sets.NewString(tt.wantRejected...); !got.Equal(want) {
+				t.Errorf("rejected = %v, want %v", got.List(), want.List())
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package internal
+
+import (
+	v14 "k8s.io/api/rbac/v1"
+	v15 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"strconv"
+	"sync"
+)
+
+// appliedBinding is subjects and roleRef of binding last written by controller
+type appliedBinding struct {
+	Subjects []v14.Subject
+	RoleRef  v14.RoleRef
+	// ResourceVersion and UID are of object returned by last write, empty until object is created
+	ResourceVersion string
+	UID             types.UID
+}
+
+// appliedBindings remembers bindings written by controller, to tell changes made by others from changes made by controller.
+// key is name of CRB, or "namespace/name" of RB
+type appliedBindings struct {
+	lock     sync.RWMutex
+	bindings map[string]appliedBinding
+}
+
+func newAppliedBindings() *appliedBindings {
+	return &appliedBindings{
+		bindings: make(map[string]appliedBinding),
+	}
+}
+
+// set records binding before it is written, so that event of the write is not taken as drift.
+// resourceVersion and UID of previous write are kept until the write returns, to ignore events of older objects meanwhile
+func (a *appliedBindings) set(key string, subjects []v14.Subject, roleRef v14.RoleRef) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	prev := a.bindings[key]
+	a.bindings[key] = appliedBinding{
+		Subjects:        append([]v14.Subject{}, subjects...),
+		RoleRef:         roleRef,
+		ResourceVersion: prev.ResourceVersion,
+		UID:             prev.UID,
+	}
+}
+
+// written records resourceVersion and UID of object returned by write, events of older objects are not taken as drift
+func (a *appliedBindings) written(key string, meta v15.ObjectMeta) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	applied, ok := a.bindings[key]
+	if !ok {
+		return
+	}
+
+	applied.ResourceVersion = meta.ResourceVersion
+	applied.UID = meta.UID
+	a.bindings[key] = applied
+}
+
+// remove forgets binding before it is deleted or released by controller
+func (a *appliedBindings) remove(key string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	delete(a.bindings, key)
+}
+
+// drift returns changes of live binding from applied binding, which should be reverted.
+// returns nil if binding is not written by controller yet, eg: right after controller is started,
+// or event is of object older than applied one, eg: update or delete of object replaced by recreation.
+func (a *appliedBindings) drift(key string, meta v15.ObjectMeta, subjects []v14.Subject, roleRef v14.RoleRef, deleted bool) []string {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+
+	applied, ok := a.bindings[key]
+	if !ok {
+		return nil
+	}
+
+	// object of another UID is deleted, or object is deleted before applied one is created
+	if deleted && (applied.UID == "" || applied.UID != meta.UID) {
+		return nil
+	}
+
+	if deleted {
+		return []string{"deleted"}
+	}
+
+	if applied.UID != "" && (applied.UID != meta.UID || isOlderVersion(meta.ResourceVersion, applied.ResourceVersion)) {
+		return nil
+	}
+
+	changes := make([]string, 0)
+	if roleRef != applied.RoleRef {
+		changes = append(changes, "roleRef changed from "+applied.RoleRef.Kind+"/"+applied.RoleRef.Name+" to "+roleRef.Kind+"/"+roleRef.Name)
+	}
+
+	appliedKeys := sets.NewString()
+	for _, subject := range applied.Subjects {
+		appliedKeys.Insert(subjectKey(subject))
+	}
+
+	liveKeys := sets.NewString()
+	for _, subject := range subjects {
+		liveKeys.Insert(subjectKey(subject))
+	}
+
+	for _, key := range liveKeys.Difference(appliedKeys).List() {
+		changes = append(changes, "subject "+key+" added")
+	}
+
+	for _, key := range appliedKeys.Difference(liveKeys).List() {
+		changes = append(changes, "subject "+key+" removed")
+	}
+
+	return changes
+}
+
+// isOlderVersion returns true if resourceVersion a is older than b.
+// resourceVersion is opaque, but it's integer in practice. false if any of them is not integer
+func isOlderVersion(a string, b string) bool {
+	aVersion, err := strconv.ParseUint(a, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	bVersion, err := strconv.ParseUint(b, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	return aVersion < bVersion
+}
+
+// Drift returns changes made to managed CRB by others since controller applied it, empty if CRB is not changed
+func (TKEAuthCRB *TKEAuthClusterRoleBindings) Drift(crb *v14.ClusterRoleBinding, deleted bool) []string {
+	if _, ok := crb.Annotations[AnnotationKeyManagedTKEAuthCRB]; !ok {
+		return nil
+	}
+
+	return TKEAuthCRB.applied.drift(crb.Name, crb.ObjectMeta, crb.Subjects, crb.RoleRef, deleted)
+}
+
+// Drift returns changes made to managed RB by others since controller applied it, empty if RB is not changed
+func (TKEAuthRB *TKEAuthRoleBindings) Drift(rb *v14.RoleBinding, deleted bool) []string {
+	if _, ok := rb.Annotations[AnnotationKeyManagedTKEAuthCRB]; !ok {
+		return nil
+	}
+
+	return TKEAuthRB.applied.drift(roleBindingKey(rb), rb.ObjectMeta, rb.Subjects, rb.RoleRef, deleted)
+}
+
+// forRecreate clears fields set by server, so that object can be created again after deleted
+func forRecreate(meta *v15.ObjectMeta) {
+	meta.ResourceVersion = ""
+	meta.UID = ""
+	meta.CreationTimestamp = v15.Time{}
+	meta.ManagedFields = nil
+}
+
+// splitRoleRefChanges returns updates keeping roleRef of old CRB, and updates binding another role.
+// roleRef is immutable, CRB binding another role should be deleted and created again.
+func splitRoleRefChanges(updates, old []*v14.ClusterRoleBinding) ([]*v14.ClusterRoleBinding, []*v14.ClusterRoleBinding) {
+	oldSet := make(map[string]*v14.ClusterRoleBinding)
+	for _, crb := range old {
+		oldSet[crb.Name] = crb
+	}
+
+	inPlace := make([]*v14.ClusterRoleBinding, 0)
+	recreations := make([]*v14.ClusterRoleBinding, 0)
+	for _, crb := range updates {
+		if oldCrb, ok := oldSet[crb.Name]; ok && oldCrb.RoleRef != crb.RoleRef {
+			forRecreate(&crb.ObjectMeta)
+			recreations = append(recreations, crb)
+		} else {
+			inPlace = append(inPlace, crb)
+		}
+	}
+
+	return inPlace, recreations
+}
+
+// splitRoleBindingRoleRefChanges returns updates keeping roleRef of old RB, and updates binding another role
+func splitRoleBindingRoleRefChanges(updates, old []*v14.RoleBinding) ([]*v14.RoleBinding, []*v14.RoleBinding) {
+	oldSet := make(map[string]*v14.RoleBinding)
+	for _, rb := range old {
+		oldSet[roleBindingKey(rb)] = rb
+	}
+
+	inPlace := make([]*v14.RoleBinding, 0)
+	recreations := make([]*v14.RoleBinding, 0)
+	for _, rb := range updates {
+		if oldRb, ok := oldSet[roleBindingKey(rb)]; ok && oldRb.RoleRef != rb.RoleRef {
+			forRecreate(&rb.ObjectMeta)
+			recreations = append(recreations, rb)
+		} else {
+			inPlace = append(inPlace, rb)
+		}
+	}
+
+	return inPlace, recreations
+}
@@ -0,0 +1,61 @@
+package internal
+
+import (
+	v14 "k8s.io/api/rbac/v1"
+	v15 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"reflect"
+	"testing"
+)
+
+func TestAppliedBindingsDrift(t *testing.T) {
+	view := toRoleRef("ClusterRole", "view")
+	edit := toRoleRef("ClusterRole", "edit")
+	subjects := []v14.Subject{userSubject("alice"), userSubject("bob")}
+
+	// applied returns appliedBindings with binding written as object of uid and resourceVersion, not returned yet if uid is empty
+	applied := func(uid types.UID, resourceVersion string) *appliedBindings {
+		a := newAppliedBindings()
+		a.set("binding", subjects, view)
+		if uid != "" {
+			a.written("binding", v15.ObjectMeta{Name: "binding", UID: uid, ResourceVersion: resourceVersion})
+		}
+
+		return a
+	}
+	live := func(uid types.UID, resourceVersion string) v15.ObjectMeta {
+		return v15.ObjectMeta{Name: "binding", UID: uid, ResourceVersion: resourceVersion}
+	}
+
+	tests := []struct {
+		name     string
+		applied  *appliedBindings
+		key      string
+		meta     v15.ObjectMeta
+		subjects []v14.Subject
+		roleRef  v14.RoleRef
+		deleted  bool
+		want     []string
+	}{
+		{"not applied yet", applied("uid-2", "20"), "other", live("uid-2", "21"), nil, view, false, nil},
+		{"unchanged", applied("uid-2", "20"), "binding", live("uid-2", "20"), subjects, view, false, []string{}},
+		{"stale update after recreation", applied("uid-2", "20"), "binding", live("uid-1", "25"), nil, edit, false, nil},
+		{"stale delete after recreation", applied("uid-2", "20"), "binding", live("uid-1", "25"), subjects, view, true, nil},
+		{"stale update of older resourceVersion", applied("uid-2", "20"), "binding", live("uid-2", "19"), nil, view, false, nil},
+		{"delete before create returns", applied("", ""), "binding", live("uid-2", "20"), subjects, view, true, nil},
+		{"update before create returns", applied("", ""), "binding", live("uid-2", "20"), subjects, view, false, []string{}},
+		{"deleted", applied("uid-2", "20"), "binding", live("uid-2", "20"), subjects, view, true, []string{"deleted"}},
+		{"non-integer resourceVersion", applied("uid-2", "b"), "binding", live("uid-2", "a"), []v14.Subject{userSubject("alice")}, view, false, []string{"subject User//bob removed"}},
+		{"subjects changed", applied("uid-2", "20"), "binding", live("uid-2", "21"), []v14.Subject{userSubject("alice"), userSubject("mallory")}, view, false, []string{"subject User//mallory added", "subject User//bob removed"}},
+		{"roleRef changed", applied("uid-2", "20"), "binding", live("uid-2", "21"), subjects, edit, false, []string{"roleRef changed from ClusterRole/view to ClusterRole/edit"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.applied.drift(tt.key, tt.meta, tt.subjects, tt.roleRef, tt.deleted)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("drift() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,330 @@
+package internal
+
+import (
+	"encoding/json"
+	"github.com/pkg/errors"
+	v14 "k8s.io/api/rbac/v1"
+	v15 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+	"time"
+)
+
+const (
+	// AnnotationKeySubjectExpiry records when each subject of binding stops being granted by expiresAt or schedule.
+	// value is json object, key is "Kind/namespace/name" of subject, value is RFC3339 time. subjects granted without limit are not recorded.
+	// expired subjects are revoked even if source of the binding fails to sync.
+	AnnotationKeySubjectExpiry = "tke-auth/subject-expiry"
+)
+
+// subjectExpiry is time when subjects stop being granted, key is subjectKey
+type subjectExpiry map[string]time.Time
+
+// parseTime parses RFC3339 time of expiresAt, notBefore. ok is false if value is empty
+func parseTime(value string) (ret time.Time, ok bool, err error) {
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+
+	ret, err = time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false, errors.Wrapf(err, "invalid time %s, should be RFC3339. eg: 2006-01-02T15:04:05+09:00", value)
+	}
+
+	return ret, true, nil
+}
+
+// formatTime returns RFC3339 string of time in TKEAuthBinding, empty if nil
+func formatTime(t *v15.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+// validateTimeRange returns error if notBefore or expiresAt cannot be parsed
+func validateTimeRange(notBefore, expiresAt string) error {
+	if _, _, err := parseTime(notBefore); err != nil {
+		return errors.Wrap(err, "notBefore")
+	}
+
+	if _, _, err := parseTime(expiresAt); err != nil {
+		return errors.Wrap(err, "expiresAt")
+	}
+
+	return nil
+}
+
+// isActive returns true if now is in [notBefore, expiresAt). invalid time is treated as inactive
+func isActive(notBefore, expiresAt string, now time.Time) bool {
+	start, ok, err := parseTime(notBefore)
+	if err != nil || (ok && now.Before(start)) {
+		return false
+	}
+
+	end, ok, err := parseTime(expiresAt)
+	if err != nil || (ok && !now.Before(end)) {
+		return false
+	}
+
+	return true
+}
+
+// isExpired returns true if expiresAt is passed
+func isExpired(expiresAt string, now time.Time) bool {
+	end, ok, err := parseTime(expiresAt)
+	return err == nil && ok && !now.Before(end)
+}
+
+// IsActive returns true if user is granted at now, by notBefore, expiresAt and schedule
+func (u *User) IsActive(now time.Time) bool {
+	return isActive(u.NotBefore, u.ExpiresAt, now) && u.Schedule.IsOpen(now)
+}
+
+// IsActive returns true if binding is granted at now, by notBefore, expiresAt and schedule
+func (t *TKEAuth) IsActive(now time.Time) bool {
+	return isActive(t.NotBefore, t.ExpiresAt, now) && t.Schedule.IsOpen(now)
+}
+
+// ExcludeInactiveUsers removes users not granted at now from Users, returns expired users as "<bindingName>/<kind>/<value>".
+// GrantedUntil of granted users is set, which is recorded to bindings by AnnotationKeySubjectExpiry.
+func (t *TKEAuth) ExcludeInactiveUsers(now time.Time) []string {
+	users := make([]User, 0, len(t.Users))
+	expired := make([]string, 0)
+
+	for _, user := range t.Users {
+		if user.IsActive(now) {
+			user.GrantedUntil = t.grantEnd(user, now)
+			users = append(users, user)
+			continue
+		}
+
+		if isExpired(user.ExpiresAt, now) {
+			expired = append(expired, t.BindingName+"/"+user.Kind+"/"+user.Value)
+		}
+	}
+
+	t.Users = users
+	return expired
+}
+
+// IsExpired returns true if expiresAt of binding is passed
+func (t *TKEAuth) IsExpired(now time.Time) bool {
+	return isExpired(t.ExpiresAt, now)
+}
+
+// NextTransition returns earliest notBefore, expiresAt or open/close of schedule after now in tkeAuths and their users, zero if none.
+// bindings should be synced again at the time, since granted users are changed.
+func NextTransition(tkeAuths []*TKEAuth, now time.Time) time.Time {
+	next := time.Time{}
+
+	updateTime := func(t time.Time) {
+		if t.IsZero() || !t.After(now) {
+			return
+		}
+
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+
+	update := func(value string) {
+		t, ok, err := parseTime(value)
+		if err == nil && ok {
+			updateTime(t)
+		}
+	}
+
+	for _, tkeAuth := range tkeAuths {
+		update(tkeAuth.NotBefore)
+		update(tkeAuth.ExpiresAt)
+		updateTime(tkeAuth.Schedule.NextTransition(now))
+
+		for _, user := range tkeAuth.Users {
+			update(user.NotBefore)
+			update(user.ExpiresAt)
+			updateTime(user.Schedule.NextTransition(now))
+		}
+	}
+
+	return next
+}
+
+// EarliestTime returns earliest non-zero time of times, zero if every time is zero
+func EarliestTime(times ...time.Time) time.Time {
+	ret := time.Time{}
+	for _, t := range times {
+		if !t.IsZero() && (ret.IsZero() || t.Before(ret)) {
+			ret = t
+		}
+	}
+
+	return ret
+}
+
+// grantEnd returns time when user granted at now stops being granted by binding, by expiresAt and close of schedule.
+// zero if user is granted without limit
+func (t *TKEAuth) grantEnd(user User, now time.Time) time.Time {
+	parse := func(value string) time.Time {
+		ret, _, _ := parseTime(value) // validated before, zero if empty
+		return ret
+	}
+
+	// schedules are open at now, next transition is close of current window
+	return EarliestTime(parse(t.ExpiresAt), parse(user.ExpiresAt), t.Schedule.NextTransition(now), user.Schedule.NextTransition(now))
+}
+
+// subjectExpiry returns time when subjects of users stop being granted, subject of any user granted without limit is not included
+func (t *TKEAuth) subjectExpiry() subjectExpiry {
+	expiry := make(subjectExpiry)
+	unlimited := make(map[string]bool)
+
+	for _, user := range t.Users {
+		key := subjectKey(userToSubject(user))
+		if user.GrantedUntil.IsZero() {
+			unlimited[key] = true
+		} else if user.GrantedUntil.After(expiry[key]) {
+			expiry[key] = user.GrantedUntil
+		}
+	}
+
+	for key := range unlimited {
+		delete(expiry, key)
+	}
+
+	return expiry
+}
+
+// getSubjectExpiry returns expiry of subjects in annotation, empty if no subject has expiry
+func getSubjectExpiry(meta v15.ObjectMeta) subjectExpiry {
+	ret := make(subjectExpiry)
+
+	value, ok := meta.Annotations[AnnotationKeySubjectExpiry]
+	if !ok {
+		return ret
+	}
+
+	raw := make(map[string]string)
+	if err := json.Unmarshal([]byte(value), &raw); err != nil {
+		klog.Warningf("cannot parse %s annotation of %s, ignoring. err: %s\n", AnnotationKeySubjectExpiry, meta.Name, err)
+		return ret
+	}
+
+	for key, value := range raw {
+		if t, ok, err := parseTime(value); err == nil && ok {
+			ret[key] = t
+		}
+	}
+
+	return ret
+}
+
+// setSubjectExpiry writes expiry of subjects to annotation, annotation is removed if expiry is empty
+func setSubjectExpiry(meta *v15.ObjectMeta, expiry subjectExpiry) {
+	if len(expiry) == 0 {
+		delete(meta.Annotations, AnnotationKeySubjectExpiry)
+		return
+	}
+
+	raw := make(map[string]string)
+	for key, t := range expiry {
+		raw[key] = t.UTC().Format(time.RFC3339)
+	}
+
+	buf, _ := json.Marshal(raw) // map of string is always marshalled
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[AnnotationKeySubjectExpiry] = string(buf)
+}
+
+// mergeSubjectExpiry returns expiry of subjects of multiple bindings merged into one.
+// subject granted by multiple bindings expires at the latest, and never if any binding grants it without limit
+func mergeSubjectExpiry(metas []v15.ObjectMeta, subjectsList [][]v14.Subject) subjectExpiry {
+	expiry := make(subjectExpiry)
+	unlimited := make(map[string]bool)
+
+	for i, meta := range metas {
+		metaExpiry := getSubjectExpiry(meta)
+		for _, subject := range subjectsList[i] {
+			key := subjectKey(subject)
+			if t, ok := metaExpiry[key]; !ok {
+				unlimited[key] = true
+			} else if t.After(expiry[key]) {
+				expiry[key] = t
+			}
+		}
+	}
+
+	for key := range unlimited {
+		delete(expiry, key)
+	}
+
+	return expiry
+}
+
+// withoutExpiredSubjects returns subjects not expired at now by AnnotationKeySubjectExpiry of meta, and expiry of returned subjects
+func withoutExpiredSubjects(meta v15.ObjectMeta, subjects []v14.Subject, now time.Time) ([]v14.Subject, subjectExpiry) {
+	expiry := getSubjectExpiry(meta)
+	ret := make([]v14.Subject, 0, len(subjects))
+	retExpiry := make(subjectExpiry)
+
+	for _, subject := range subjects {
+		key := subjectKey(subject)
+		t, ok := expiry[key]
+		if ok && !now.Before(t) {
+			continue
+		}
+
+		ret = append(ret, subject)
+		if ok {
+			retExpiry[key] = t
+		}
+	}
+
+	return ret, retExpiry
+}
+
+// nextSubjectExpiry returns earliest expiry of subjects after now in metas, zero if none
+func nextSubjectExpiry(metas []v15.ObjectMeta, now time.Time) time.Time {
+	next := time.Time{}
+	for _, meta := range metas {
+		for _, t := range getSubjectExpiry(meta) {
+			if t.After(now) {
+				next = EarliestTime(next, t)
+			}
+		}
+	}
+
+	return next
+}
+
+// NextSubjectExpiry returns earliest expiry of subjects after now in managed ClusterRoleBindings, zero if none
+func (TKEAuthCRB *TKEAuthClusterRoleBindings) NextSubjectExpiry(now time.Time) (time.Time, error) {
+	CRBs, err := TKEAuthCRB.getClusterRoleBindings()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	metas := make([]v15.ObjectMeta, 0)
+	for _, crb := range CRBs {
+		metas = append(metas, crb.ObjectMeta)
+	}
+
+	return nextSubjectExpiry(metas, now), nil
+}
+
+// NextSubjectExpiry returns earliest expiry of subjects after now in managed RoleBindings, zero if none
+func (TKEAuthRB *TKEAuthRoleBindings) NextSubjectExpiry(now time.Time) (time.Time, error) {
+	RBs, err := TKEAuthRB.getRoleBindings()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	metas := make([]v15.ObjectMeta, 0)
+	for _, rb := range RBs {
+		metas = append(metas, rb.ObjectMeta)
+	}
+
+	return nextSubjectExpiry(metas, now), nil
+}
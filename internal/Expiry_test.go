@@ -0,0 +1,80 @@
+package internal
+
+import (
+	v14 "k8s.io/api/rbac/v1"
+	v15 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var expiryTestNow = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestExcludeInactiveUsersSetsSubjectExpiry(t *testing.T) {
+	tkeAuth := &TKEAuth{
+		BindingName: "binding",
+		RoleKind:    "ClusterRole",
+		RoleName:    "view",
+		ExpiresAt:   "2024-01-03T00:00:00Z",
+		Users: []User{
+			{Value: "alice", ExpiresAt: "2024-01-02T00:00:00Z"},
+			{Value: "bob"},
+			{Value: "carol", Schedule: &Schedule{Cron: "0 9 * * *", Duration: "8h"}},
+			{Value: "dave", ExpiresAt: "2024-01-01T00:00:00Z"},
+		},
+	}
+
+	tkeAuth.ExcludeInactiveUsers(expiryTestNow)
+
+	crb := tkeAuth.ToClusterRoleBinding()
+	want := subjectExpiry{
+		subjectKey(userSubject("alice")): time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		subjectKey(userSubject("bob")):   time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC),
+		subjectKey(userSubject("carol")): time.Date(2024, 1, 1, 17, 0, 0, 0, time.UTC),
+	}
+	if got := getSubjectExpiry(crb.ObjectMeta); !reflect.DeepEqual(got, want) {
+		t.Errorf("subject expiry = %v, want %v", got, want)
+	}
+}
+
+func TestWithoutExpiredSubjects(t *testing.T) {
+	meta := v15.ObjectMeta{Name: "binding"}
+	setSubjectExpiry(&meta, subjectExpiry{
+		subjectKey(userSubject("alice")): expiryTestNow.Add(-time.Minute),
+		subjectKey(userSubject("bob")):   expiryTestNow,
+		subjectKey(userSubject("carol")): expiryTestNow.Add(time.Minute),
+	})
+	subjects := []v14.Subject{userSubject("alice"), userSubject("bob"), userSubject("carol"), userSubject("dave")}
+
+	got, expiry := withoutExpiredSubjects(meta, subjects, expiryTestNow)
+	if names, want := subjectNames(got), []string{"carol", "dave"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("subjects = %v, want %v", names, want)
+	}
+	if want := (subjectExpiry{subjectKey(userSubject("carol")): expiryTestNow.Add(time.Minute)}); !reflect.DeepEqual(expiry, want) {
+		t.Errorf("expiry = %v, want %v", expiry, want)
+	}
+
+	if next := nextSubjectExpiry([]v15.ObjectMeta{meta}, expiryTestNow); !next.Equal(expiryTestNow.Add(time.Minute)) {
+		t.Errorf("next expiry = %s, want %s", next, expiryTestNow.Add(time.Minute))
+	}
+}
+
+func TestMergeSubjectExpiry(t *testing.T) {
+	a, b := v15.ObjectMeta{Name: "a"}, v15.ObjectMeta{Name: "b"}
+	setSubjectExpiry(&a, subjectExpiry{
+		subjectKey(userSubject("alice")): expiryTestNow,
+		subjectKey(userSubject("bob")):   expiryTestNow,
+	})
+	setSubjectExpiry(&b, subjectExpiry{
+		subjectKey(userSubject("alice")): expiryTestNow.Add(time.Hour),
+	})
+
+	// alice expires at latest of both, bob is granted by b without limit
+	got := mergeSubjectExpiry([]v15.ObjectMeta{a, b}, [][]v14.Subject{
+		{userSubject("alice"), userSubject("bob")},
+		{userSubject("alice"), userSubject("bob")},
+	})
+	if want := (subjectExpiry{subjectKey(userSubject("alice")): expiryTestNow.Add(time.Hour)}); !reflect.DeepEqual(got, want) {
+		t.Errorf("merged expiry = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"example.com/tke-auth-controller/internal/apis/tkeauth/v1alpha1"
+	"github.com/pkg/errors"
+	v12 "k8s.io/api/core/v1"
+	v14 "k8s.io/api/rbac/v1"
+	v15 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// FinalizerRevokeBindings is added to every source, deletion of source waits until its bindings are revoked by controller.
+	// cluster-scoped bindings cannot have namespaced owner, so source is tracked by source annotations instead of ownerReferences.
+	FinalizerRevokeBindings = "tkeauth.pubg.io/revoke-bindings"
+	// AnnotationKeyOrphanOnDelete keeps bindings of source when source is deleted if "true".
+	// orphaned bindings are not managed by controller anymore.
+	AnnotationKeyOrphanOnDelete = "tke-auth/orphan-on-delete"
+)
+
+// HasFinalizer returns true if object has FinalizerRevokeBindings
+func HasFinalizer(meta v15.ObjectMeta) bool {
+	return sets.NewString(meta.Finalizers...).Has(FinalizerRevokeBindings)
+}
+
+// IsOrphanOnDelete returns true if bindings of source should be kept when source is deleted
+func IsOrphanOnDelete(meta v15.ObjectMeta) bool {
+	return meta.Annotations[AnnotationKeyOrphanOnDelete] == "true"
+}
+
+// IsReleased returns true if configMap or secret is deleted or "tke-auth/binding" annotation is removed, while it still has finalizer.
+// bindings of released source should be revoked, then finalizer is removed.
+func IsReleased(meta v15.ObjectMeta) bool {
+	return meta.DeletionTimestamp != nil || !v15.HasAnnotation(meta, AnnotationKeyTKEAuthConfigMap)
+}
+
+// finalizerPatch returns merge patch of finalizers with FinalizerRevokeBindings added or removed.
+// resourceVersion is included, so that finalizers changed by others are not overwritten.
+func finalizerPatch(meta v15.ObjectMeta, add bool) ([]byte, error) {
+	finalizers := make([]string, 0)
+	for _, finalizer := range meta.Finalizers {
+		if finalizer != FinalizerRevokeBindings {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+
+	if add {
+		finalizers = append(finalizers, FinalizerRevokeBindings)
+	}
+
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"finalizers":      finalizers,
+			"resourceVersion": meta.ResourceVersion,
+		},
+	}
+
+	return json.Marshal(patch)
+}
+
+// SetFinalizer adds or removes FinalizerRevokeBindings of configMap
+// resourceVersion of cfgMap is updated to patched one, so that update event of finalizer is regarded as already synced
+func (cfg *TKEAuthConfigMaps) SetFinalizer(cfgMap *v12.ConfigMap, add bool) error {
+	buf, err := finalizerPatch(cfgMap.ObjectMeta, add)
+	if err != nil {
+		return err
+	}
+
+	patched, err := cfg.cmGetter.ConfigMaps(cfgMap.Namespace).Patch(context.TODO(), cfgMap.Name, types.MergePatchType, buf, v15.PatchOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "cannot update finalizer of configMap %s/%s", cfgMap.Namespace, cfgMap.Name)
+	}
+	cfgMap.ResourceVersion = patched.ResourceVersion
+
+	return nil
+}
+
+// SetFinalizer adds or removes FinalizerRevokeBindings of secret
+// resourceVersion of secret is updated to patched one, so that update event of finalizer is regarded as already synced
+func (s *TKEAuthSecrets) SetFinalizer(secret *v12.Secret, add bool) error {
+	buf, err := finalizerPatch(secret.ObjectMeta, add)
+	if err != nil {
+		return err
+	}
+
+	patched, err := s.secretGetter.Secrets(secret.Namespace).Patch(context.TODO(), secret.Name, types.MergePatchType, buf, v15.PatchOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "cannot update finalizer of secret %s/%s", secret.Namespace, secret.Name)
+	}
+	secret.ResourceVersion = patched.ResourceVersion
+
+	return nil
+}
+
+// SetFinalizer adds or removes FinalizerRevokeBindings of TKEAuthBinding
+// resourceVersion of binding is updated to patched one, so that update event of finalizer is regarded as already synced
+func (b *TKEAuthBindings) SetFinalizer(binding *v1alpha1.TKEAuthBinding, add bool) error {
+	buf, err := finalizerPatch(binding.ObjectMeta, add)
+	if err != nil {
+		return err
+	}
+
+	patched, err := b.bindingGetter.TKEAuthBindings(binding.Namespace).Patch(context.TODO(), binding.Name, types.MergePatchType, buf, v15.PatchOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "cannot update finalizer of TKEAuthBinding %s/%s", binding.Namespace, binding.Name)
+	}
+	binding.ResourceVersion = patched.ResourceVersion
+
+	return nil
+}
+
+// releaseMeta removes annotations of controller from object, object is not managed by controller anymore
+func releaseMeta(meta *v15.ObjectMeta) {
+	for _, key := range []string{AnnotationKeyManagedTKEAuthCRB, AnnotationKeySource, AnnotationKeySourceUID, AnnotationKeySubjectSources, AnnotationKeySubjectExpiry, AnnotationKeyAdoptedSubjects} {
+		delete(meta.Annotations, key)
+	}
+}
+
+// isCreatedOnlyFromSources returns true if every source of object is in sources
+func isCreatedOnlyFromSources(meta v15.ObjectMeta, sources sets.String) bool {
+	objectSources := SourcesOf(meta)
+	return len(objectSources) > 0 && sources.HasAll(objectSources...)
+}
+
+// ReleaseClusterRoleBindings orphans managed CRBs created only from sources, they are kept and not managed anymore
+func (TKEAuthCRB *TKEAuthClusterRoleBindings) ReleaseClusterRoleBindings(sources sets.String) error {
+	CRBs, err := TKEAuthCRB.getClusterRoleBindings()
+	if err != nil {
+		return err
+	}
+
+	releases := make([]*v14.ClusterRoleBinding, 0)
+	for _, crb := range CRBs {
+		if isCreatedOnlyFromSources(crb.ObjectMeta, sources) {
+			klog.Infof("orphaning CRB %s of source %s\n", crb.Name, crb.Annotations[AnnotationKeySource])
+			releaseMeta(&crb.ObjectMeta)
+			releases = append(releases, crb)
+		}
+	}
+
+	return TKEAuthCRB.updateCRBs(releases)
+}
+
+// ReleaseRoleBindings orphans managed RBs created only from sources
+func (TKEAuthRB *TKEAuthRoleBindings) ReleaseRoleBindings(sources sets.String) error {
+	RBs, err := TKEAuthRB.getRoleBindings()
+	if err != nil {
+		return err
+	}
+
+	releases := make([]*v14.RoleBinding, 0)
+	for _, rb := range RBs {
+		if isCreatedOnlyFromSources(rb.ObjectMeta, sources) {
+			klog.Infof("orphaning RB %s of source %s\n", roleBindingKey(rb), rb.Annotations[AnnotationKeySource])
+			releaseMeta(&rb.ObjectMeta)
+			releases = append(releases, rb)
+		}
+	}
+
+	return TKEAuthRB.updateRBs(releases)
+}
+
+// ReleaseClusterRoles orphans managed ClusterRoles created only from sources
+func (roles *TKEAuthRoles) ReleaseClusterRoles(sources sets.String) error {
+	CRs, err := roles.getClusterRoles()
+	if err != nil {
+		return err
+	}
+
+	releases := make([]*v14.ClusterRole, 0)
+	for _, cr := range CRs {
+		if isCreatedOnlyFromSources(cr.ObjectMeta, sources) {
+			klog.Infof("orphaning ClusterRole %s of source %s\n", cr.Name, cr.Annotations[AnnotationKeySource])
+			releaseMeta(&cr.ObjectMeta)
+			releases = append(releases, cr)
+		}
+	}
+
+	return roles.updateClusterRoles(releases)
+}
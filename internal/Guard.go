@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"github.com/pkg/errors"
+	v15 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strings"
+)
+
+const (
+	// AnnotationKeyAllowDeletion allows managed binding to be deleted regardless of DeletionGuard if "true"
+	AnnotationKeyAllowDeletion = "tke-auth/allow-deletion"
+)
+
+// DeletionGuard refuses sync deleting too many managed bindings and ClusterRoles at once, eg: sources are removed by mistake.
+// deleting every binding locks everybody out of cluster, so it should be confirmed explicitly.
+// deleting ClusterRole revokes every binding of it, so ClusterRoles are counted same as bindings.
+type DeletionGuard struct {
+	// MaxDeletions is max number of bindings and ClusterRoles deleted by a sync, unlimited if 0
+	MaxDeletions int
+	// MaxDeletionPercent is max percentage of managed bindings and ClusterRoles deleted by a sync, unlimited if 0
+	MaxDeletionPercent int
+	// Disabled allows every deletion
+	Disabled bool
+}
+
+// isAllowedDeletion returns true if binding or ClusterRole is annotated to be deleted regardless of guard
+func isAllowedDeletion(meta v15.ObjectMeta) bool {
+	return meta.Annotations[AnnotationKeyAllowDeletion] == "true"
+}
+
+// Check returns error if plans delete more bindings and ClusterRoles than limits of guard.
+// objects with "tke-auth/allow-deletion" annotation and bindings recreated to change roleRef are not counted.
+func (g DeletionGuard) Check(crPlan *ClusterRolePlan, crbPlan *ClusterRoleBindingPlan, rbPlan *RoleBindingPlan) error {
+	if g.Disabled {
+		return nil
+	}
+
+	deletions := make([]string, 0)
+	for _, cr := range crPlan.Deletions {
+		if !isAllowedDeletion(cr.ObjectMeta) {
+			deletions = append(deletions, "ClusterRole/"+cr.Name)
+		}
+	}
+
+	for _, crb := range crbPlan.Deletions {
+		if !isAllowedDeletion(crb.ObjectMeta) {
+			deletions = append(deletions, "ClusterRoleBinding/"+crb.Name)
+		}
+	}
+
+	for _, rb := range rbPlan.Deletions {
+		if !isAllowedDeletion(rb.ObjectMeta) {
+			deletions = append(deletions, "RoleBinding/"+roleBindingKey(rb))
+		}
+	}
+
+	managed := crPlan.Managed + crbPlan.Managed + rbPlan.Managed
+	if len(deletions) == 0 || managed == 0 {
+		return nil
+	}
+
+	exceeded := g.MaxDeletions > 0 && len(deletions) > g.MaxDeletions
+	exceeded = exceeded || g.MaxDeletionPercent > 0 && len(deletions)*100 > managed*g.MaxDeletionPercent
+	if !exceeded {
+		return nil
+	}
+
+	return errors.Errorf("refusing to delete %d of %d managed bindings and ClusterRoles, maxDeletions: %d, maxDeletionPercent: %d: %s. annotate them with %s: \"true\" or run with -allowMassDeletion to delete them",
+		len(deletions), managed, g.MaxDeletions, g.MaxDeletionPercent, strings.Join(deletions, ", "), AnnotationKeyAllowDeletion)
+}
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	v14 "k8s.io/api/rbac/v1"
+	v15 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"strconv"
+	"testing"
+)
+
+// guardTestPlans returns plans deleting crbDeletions CRBs, rbDeletions RBs and crDeletions ClusterRoles out of managed objects.
+// first allowed objects of each kind have "tke-auth/allow-deletion" annotation
+func guardTestPlans(crDeletions, crbDeletions, rbDeletions, allowed, managed int) (*ClusterRolePlan, *ClusterRoleBindingPlan, *RoleBindingPlan) {
+	meta := func(i int) v15.ObjectMeta {
+		meta := v15.ObjectMeta{Name: "binding-" + strconv.Itoa(i), Namespace: "ns", Annotations: map[string]string{}}
+		if i < allowed {
+			meta.Annotations[AnnotationKeyAllowDeletion] = "true"
+		}
+		return meta
+	}
+
+	crPlan := &ClusterRolePlan{}
+	for i := 0; i < crDeletions; i++ {
+		crPlan.Deletions = append(crPlan.Deletions, &v14.ClusterRole{ObjectMeta: meta(i)})
+	}
+
+	crbPlan := &ClusterRoleBindingPlan{Managed: managed}
+	for i := 0; i < crbDeletions; i++ {
+		crbPlan.Deletions = append(crbPlan.Deletions, &v14.ClusterRoleBinding{ObjectMeta: meta(i)})
+	}
+
+	rbPlan := &RoleBindingPlan{}
+	for i := 0; i < rbDeletions; i++ {
+		rbPlan.Deletions = append(rbPlan.Deletions, &v14.RoleBinding{ObjectMeta: meta(i)})
+	}
+
+	return crPlan, crbPlan, rbPlan
+}
+
+func TestDeletionGuardCheck(t *testing.T) {
+	tests := []struct {
+		name                                   string
+		guard                                  DeletionGuard
+		crDeletions, crbDeletions, rbDeletions int
+		allowed, managed                       int
+		wantErr                                bool
+	}{
+		{"no deletion", DeletionGuard{MaxDeletions: 1, MaxDeletionPercent: 1}, 0, 0, 0, 0, 10, false},
+		{"unlimited", DeletionGuard{}, 0, 100, 100, 0, 200, false},
+		{"deletions equal to max", DeletionGuard{MaxDeletions: 3}, 0, 2, 1, 0, 100, false},
+		{"deletions over max", DeletionGuard{MaxDeletions: 3}, 0, 2, 2, 0, 100, true},
+		{"ClusterRoles are counted", DeletionGuard{MaxDeletions: 3}, 1, 2, 1, 0, 100, true},
+		{"allowed deletions are not counted", DeletionGuard{MaxDeletions: 3}, 1, 2, 2, 1, 100, false},
+		{"disabled", DeletionGuard{MaxDeletions: 1, Disabled: true}, 1, 5, 5, 0, 100, false},
+		{"percent equal to max", DeletionGuard{MaxDeletionPercent: 50}, 0, 5, 0, 0, 10, false},
+		{"percent over max", DeletionGuard{MaxDeletionPercent: 50}, 0, 5, 1, 0, 10, true},
+		{"percent is not rounded down", DeletionGuard{MaxDeletionPercent: 33}, 0, 1, 0, 0, 3, true},
+		{"every binding deleted", DeletionGuard{MaxDeletionPercent: 100}, 0, 10, 0, 0, 10, false},
+		{"nothing managed", DeletionGuard{MaxDeletions: 1, MaxDeletionPercent: 1}, 0, 0, 0, 0, 0, false},
+		{"any of limits exceeded", DeletionGuard{MaxDeletions: 100, MaxDeletionPercent: 10}, 0, 2, 0, 0, 10, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			crPlan, crbPlan, rbPlan := guardTestPlans(tt.crDeletions, tt.crbDeletions, tt.rbDeletions, tt.allowed, tt.managed)
+
+			err := tt.guard.Check(crPlan, crbPlan, rbPlan)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Check() = %v, wantErr %t", err, tt.wantErr)
+			}
+		})
+	}
+}
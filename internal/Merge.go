@@ -0,0 +1,244 @@
+package internal
+
+import (
+	"encoding/json"
+	v14 "k8s.io/api/rbac/v1"
+	v15 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/klog/v2"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// AnnotationKeySubjectSources records which sources contributed each subject of merged binding.
+	// value is json object, key is "Kind/namespace/name" of subject, value is list of source keys.
+	AnnotationKeySubjectSources = "tke-auth/subject-sources"
+)
+
+// subjectSources is provenance of subjects, key is subjectKey, value is set of SourceKey
+type subjectSources map[string]sets.String
+
+func subjectKey(subject v14.Subject) string {
+	return subject.Kind + "/" + subject.Namespace + "/" + subject.Name
+}
+
+// SourcesOf returns source keys in source annotation. merged binding has multiple sources joined by ","
+func SourcesOf(meta v15.ObjectMeta) []string {
+	source, ok := meta.Annotations[AnnotationKeySource]
+	if !ok || source == "" {
+		return []string{}
+	}
+
+	return strings.Split(source, ",")
+}
+
+// getSubjectSources returns provenance of subjects in annotation, empty if binding is not merged
+func getSubjectSources(meta v15.ObjectMeta) subjectSources {
+	ret := make(subjectSources)
+
+	value, ok := meta.Annotations[AnnotationKeySubjectSources]
+	if !ok {
+		return ret
+	}
+
+	raw := make(map[string][]string)
+	err := json.Unmarshal([]byte(value), &raw)
+	if err != nil {
+		klog.Warningf("cannot parse %s annotation of %s, ignoring. err: %s\n", AnnotationKeySubjectSources, meta.Name, err)
+		return ret
+	}
+
+	for key, sources := range raw {
+		ret[key] = sets.NewString(sources...)
+	}
+
+	return ret
+}
+
+func setSubjectSources(meta *v15.ObjectMeta, provenance subjectSources) {
+	raw := make(map[string][]string)
+	for key, sources := range provenance {
+		raw[key] = sources.List()
+	}
+
+	buf, _ := json.Marshal(raw) // map of string slice is always marshalled
+	if meta.Annotations == nil {
+		meta.Annotations = map[string]string{}
+	}
+	meta.Annotations[AnnotationKeySubjectSources] = string(buf)
+}
+
+// newSubjectSources returns provenance of subjects, every subject is contributed by source
+func newSubjectSources(subjects []v14.Subject, source string) subjectSources {
+	provenance := make(subjectSources)
+	for _, subject := range subjects {
+		provenance[subjectKey(subject)] = sets.NewString(source)
+	}
+
+	return provenance
+}
+
+// mergeSubjects unions subjects of multiple bindings with same name, and records which source contributed each subject
+func mergeSubjects(metas []v15.ObjectMeta, subjectsList [][]v14.Subject) ([]v14.Subject, subjectSources, []string) {
+	subjects := make(map[string]v14.Subject)
+	provenance := make(subjectSources)
+	sources := sets.NewString()
+
+	for i, meta := range metas {
+		metaSources := SourcesOf(meta)
+		metaProvenance := getSubjectSources(meta)
+		sources.Insert(metaSources...)
+
+		for _, subject := range subjectsList[i] {
+			key := subjectKey(subject)
+			subjects[key] = subject
+
+			if _, ok := provenance[key]; !ok {
+				provenance[key] = sets.NewString()
+			}
+
+			if contributors, ok := metaProvenance[key]; ok {
+				provenance[key].Insert(contributors.UnsortedList()...)
+			} else {
+				provenance[key].Insert(metaSources...)
+			}
+		}
+	}
+
+	keys := make([]string, 0)
+	for key := range subjects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	ret := make([]v14.Subject, 0)
+	for _, key := range keys {
+		ret = append(ret, subjects[key])
+	}
+
+	return ret, provenance, sources.List()
+}
+
+// MergeClusterRoleBindings merges CRBs with same name created from different sources into one CRB.
+// sources are allowed to share a binding only in merge mode, see DetectConflicts.
+func MergeClusterRoleBindings(CRBs []*v14.ClusterRoleBinding) []*v14.ClusterRoleBinding {
+	groups := make(map[string][]*v14.ClusterRoleBinding)
+	names := make([]string, 0)
+
+	for _, crb := range CRBs {
+		if _, ok := groups[crb.Name]; !ok {
+			names = append(names, crb.Name)
+		}
+		groups[crb.Name] = append(groups[crb.Name], crb)
+	}
+
+	ret := make([]*v14.ClusterRoleBinding, 0)
+	for _, name := range names {
+		group := groups[name]
+		if len(group) == 1 {
+			ret = append(ret, group[0])
+			continue
+		}
+
+		metas := make([]v15.ObjectMeta, 0)
+		subjectsList := make([][]v14.Subject, 0)
+		for _, crb := range group {
+			metas = append(metas, crb.ObjectMeta)
+			subjectsList = append(subjectsList, crb.Subjects)
+		}
+
+		merged := group[0].DeepCopy()
+		subjects, provenance, sources := mergeSubjects(metas, subjectsList)
+		merged.Subjects = subjects
+		merged.Annotations[AnnotationKeySource] = strings.Join(sources, ",")
+		mergeSourceUIDs(&merged.ObjectMeta, metas)
+		setSubjectSources(&merged.ObjectMeta, provenance)
+		setSubjectExpiry(&merged.ObjectMeta, mergeSubjectExpiry(metas, subjectsList))
+
+		ret = append(ret, merged)
+	}
+
+	return ret
+}
+
+// MergeRoleBindings merges RBs with same namespace and name created from different sources into one RB.
+func MergeRoleBindings(RBs []*v14.RoleBinding) []*v14.RoleBinding {
+	groups := make(map[string][]*v14.RoleBinding)
+	keys := make([]string, 0)
+
+	for _, rb := range RBs {
+		key := roleBindingKey(rb)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], rb)
+	}
+
+	ret := make([]*v14.RoleBinding, 0)
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) == 1 {
+			ret = append(ret, group[0])
+			continue
+		}
+
+		metas := make([]v15.ObjectMeta, 0)
+		subjectsList := make([][]v14.Subject, 0)
+		for _, rb := range group {
+			metas = append(metas, rb.ObjectMeta)
+			subjectsList = append(subjectsList, rb.Subjects)
+		}
+
+		merged := group[0].DeepCopy()
+		subjects, provenance, sources := mergeSubjects(metas, subjectsList)
+		merged.Subjects = subjects
+		merged.Annotations[AnnotationKeySource] = strings.Join(sources, ",")
+		mergeSourceUIDs(&merged.ObjectMeta, metas)
+		setSubjectSources(&merged.ObjectMeta, provenance)
+		setSubjectExpiry(&merged.ObjectMeta, mergeSubjectExpiry(metas, subjectsList))
+
+		ret = append(ret, merged)
+	}
+
+	return ret
+}
+
+// retainSubjectsOfSources returns subjects of new binding, with subjects of old binding contributed by skipSources added.
+// it keeps users of a failed source in merged binding, while other sources of the binding are synced. expired subjects are not kept.
+func retainSubjectsOfSources(newMeta *v15.ObjectMeta, newSubjects []v14.Subject, oldMeta v15.ObjectMeta, oldSubjects []v14.Subject, skipSources sets.String) []v14.Subject {
+	oldProvenance := getSubjectSources(oldMeta)
+	if len(oldProvenance) == 0 || skipSources.Len() == 0 {
+		return newSubjects
+	}
+
+	retainedSubjects := make([]v14.Subject, 0)
+	retainedMeta := oldMeta.DeepCopy()
+	retainedProvenance := make(subjectSources)
+
+	oldSubjects, _ = withoutExpiredSubjects(oldMeta, oldSubjects, time.Now())
+	for _, subject := range oldSubjects {
+		key := subjectKey(subject)
+		failedContributors := oldProvenance[key].Intersection(skipSources)
+		if failedContributors.Len() > 0 {
+			retainedSubjects = append(retainedSubjects, subject)
+			retainedProvenance[key] = failedContributors
+		}
+	}
+
+	if len(retainedSubjects) == 0 {
+		return newSubjects
+	}
+
+	retainedMeta.Annotations[AnnotationKeySource] = strings.Join(sets.NewString(SourcesOf(oldMeta)...).Intersection(skipSources).List(), ",")
+	setSubjectSources(retainedMeta, retainedProvenance)
+
+	subjects, provenance, sources := mergeSubjects([]v15.ObjectMeta{*newMeta, *retainedMeta}, [][]v14.Subject{newSubjects, retainedSubjects})
+	newMeta.Annotations[AnnotationKeySource] = strings.Join(sources, ",")
+	mergeSourceUIDs(newMeta, []v15.ObjectMeta{*newMeta, *retainedMeta})
+	setSubjectSources(newMeta, provenance)
+	setSubjectExpiry(newMeta, mergeSubjectExpiry([]v15.ObjectMeta{*newMeta, *retainedMeta}, [][]v14.Subject{newSubjects, retainedSubjects}))
+
+	return subjects
+}
@@ -0,0 +1,230 @@
+package internal
+
+import (
+	v14 "k8s.io/api/rbac/v1"
+	v15 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"reflect"
+	"testing"
+)
+
+const (
+	sourceA = "ConfigMap/team-a/binding"
+	sourceB = "ConfigMap/team-b/binding"
+)
+
+func userSubject(name string) v14.Subject {
+	return v14.Subject{Kind: "User", APIGroup: "rbac.authorization.k8s.io", Name: name}
+}
+
+func subjectNames(subjects []v14.Subject) []string {
+	names := make([]string, 0)
+	for _, subject := range subjects {
+		names = append(names, subject.Name)
+	}
+
+	return names
+}
+
+// mergeTestMeta returns meta of binding created from source, with provenance of subjects if merge is true
+func mergeTestMeta(name string, source string, subjects []v14.Subject, merge bool) v15.ObjectMeta {
+	meta := v15.ObjectMeta{
+		Name: name,
+		Annotations: map[string]string{
+			AnnotationKeySource:    source,
+			AnnotationKeySourceUID: "uid-of-" + source,
+		},
+	}
+
+	if merge {
+		setSubjectSources(&meta, newSubjectSources(subjects, source))
+	}
+
+	return meta
+}
+
+func mergeTestCRB(name string, source string, users ...string) *v14.ClusterRoleBinding {
+	subjects := make([]v14.Subject, 0)
+	for _, user := range users {
+		subjects = append(subjects, userSubject(user))
+	}
+
+	return &v14.ClusterRoleBinding{
+		ObjectMeta: mergeTestMeta(name, source, subjects, true),
+		Subjects:   subjects,
+		RoleRef:    toRoleRef("ClusterRole", "view"),
+	}
+}
+
+// provenanceOf returns provenance in annotation as map of sorted lists
+func provenanceOf(meta v15.ObjectMeta) map[string][]string {
+	ret := make(map[string][]string)
+	for key, sources := range getSubjectSources(meta) {
+		ret[key] = sources.List()
+	}
+
+	return ret
+}
+
+func userKey(name string) string {
+	return subjectKey(userSubject(name))
+}
+
+func TestMergeClusterRoleBindings(t *testing.T) {
+	CRBs := []*v14.ClusterRoleBinding{
+		mergeTestCRB("shared", sourceA, "alice", "carol"),
+		mergeTestCRB("other", sourceA, "alice"),
+		mergeTestCRB("shared", sourceB, "bob", "carol"),
+	}
+
+	merged := MergeClusterRoleBindings(CRBs)
+	if len(merged) != 2 {
+		t.Fatalf("expected 2 CRBs, got %d", len(merged))
+	}
+
+	shared, other := merged[0], merged[1]
+	if shared.Name != "shared" || other.Name != "other" {
+		t.Fatalf("expected order of first appearance, got %s, %s", shared.Name, other.Name)
+	}
+
+	if got, want := subjectNames(shared.Subjects), []string{"alice", "bob", "carol"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("subjects = %v, want %v", got, want)
+	}
+
+	if got, want := SourcesOf(shared.ObjectMeta), []string{sourceA, sourceB}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sources = %v, want %v", got, want)
+	}
+
+	if got, want := shared.Annotations[AnnotationKeySourceUID], "uid-of-"+sourceA+",uid-of-"+sourceB; got != want {
+		t.Errorf("source uids = %s, want %s", got, want)
+	}
+
+	wantProvenance := map[string][]string{
+		userKey("alice"): {sourceA},
+		userKey("bob"):   {sourceB},
+		userKey("carol"): {sourceA, sourceB},
+	}
+	if got := provenanceOf(shared.ObjectMeta); !reflect.DeepEqual(got, wantProvenance) {
+		t.Errorf("provenance = %v, want %v", got, wantProvenance)
+	}
+
+	if other != CRBs[1] {
+		t.Errorf("CRB not shared should be returned as-is")
+	}
+}
+
+func TestMergeRoleBindingsKeepsNamespacesApart(t *testing.T) {
+	rb := func(namespace string, source string, user string) *v14.RoleBinding {
+		subjects := []v14.Subject{userSubject(user)}
+		meta := mergeTestMeta("binding", source, subjects, true)
+		meta.Namespace = namespace
+
+		return &v14.RoleBinding{ObjectMeta: meta, Subjects: subjects, RoleRef: toRoleRef("ClusterRole", "view")}
+	}
+
+	merged := MergeRoleBindings([]*v14.RoleBinding{
+		rb("ns-1", sourceA, "alice"),
+		rb("ns-2", sourceB, "bob"),
+		rb("ns-1", sourceB, "bob"),
+	})
+	if len(merged) != 2 {
+		t.Fatalf("expected 2 RBs, got %d", len(merged))
+	}
+
+	if got, want := subjectNames(merged[0].Subjects), []string{"alice", "bob"}; merged[0].Namespace != "ns-1" || !reflect.DeepEqual(got, want) {
+		t.Errorf("RB of ns-1 has subjects %v, want %v", got, want)
+	}
+
+	if got, want := subjectNames(merged[1].Subjects), []string{"bob"}; merged[1].Namespace != "ns-2" || !reflect.DeepEqual(got, want) {
+		t.Errorf("RB of ns-2 has subjects %v, want %v", got, want)
+	}
+}
+
+func TestMergeSubjectsWithoutProvenance(t *testing.T) {
+	// binding created before merge mode has no provenance, every subject is contributed by its sources
+	metas := []v15.ObjectMeta{
+		mergeTestMeta("shared", sourceA, nil, false),
+		mergeTestMeta("shared", sourceB, []v14.Subject{userSubject("bob")}, true),
+	}
+
+	subjects, provenance, sources := mergeSubjects(metas, [][]v14.Subject{{userSubject("alice")}, {userSubject("bob")}})
+	if got, want := subjectNames(subjects), []string{"alice", "bob"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("subjects = %v, want %v", got, want)
+	}
+
+	if got, want := sources, []string{sourceA, sourceB}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sources = %v, want %v", got, want)
+	}
+
+	if got := provenance[userKey("alice")]; !got.Equal(sets.NewString(sourceA)) {
+		t.Errorf("provenance of alice = %v, want %s", got.List(), sourceA)
+	}
+}
+
+func TestRetainSubjectsOfSources(t *testing.T) {
+	old := mergeTestCRB("shared", sourceA+","+sourceB)
+	old.Subjects = []v14.Subject{userSubject("alice"), userSubject("bob"), userSubject("carol")}
+	setSubjectSources(&old.ObjectMeta, subjectSources{
+		userKey("alice"): sets.NewString(sourceA),
+		userKey("bob"):   sets.NewString(sourceB),
+		userKey("carol"): sets.NewString(sourceA, sourceB),
+	})
+
+	tests := []struct {
+		name           string
+		skipSources    sets.String
+		wantSubjects   []string
+		wantSources    []string
+		wantProvenance map[string][]string
+	}{
+		{
+			name:         "nothing skipped, only subjects of new binding",
+			skipSources:  sets.NewString(),
+			wantSubjects: []string{"alice"},
+			wantSources:  []string{sourceA},
+			wantProvenance: map[string][]string{
+				userKey("alice"): {sourceA},
+			},
+		},
+		{
+			name:         "subjects contributed by skipped source are kept",
+			skipSources:  sets.NewString(sourceB),
+			wantSubjects: []string{"alice", "bob", "carol"},
+			wantSources:  []string{sourceA, sourceB},
+			wantProvenance: map[string][]string{
+				userKey("alice"): {sourceA},
+				userKey("bob"):   {sourceB},
+				userKey("carol"): {sourceB},
+			},
+		},
+		{
+			name:         "source not in old binding is ignored",
+			skipSources:  sets.NewString("ConfigMap/team-c/binding"),
+			wantSubjects: []string{"alice"},
+			wantSources:  []string{sourceA},
+			wantProvenance: map[string][]string{
+				userKey("alice"): {sourceA},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// source A removed carol, bob is only contributed by source B
+			new := mergeTestCRB("shared", sourceA, "alice")
+
+			subjects := retainSubjectsOfSources(&new.ObjectMeta, new.Subjects, old.ObjectMeta, old.Subjects, tt.skipSources)
+			if got := subjectNames(subjects); !reflect.DeepEqual(got, tt.wantSubjects) {
+				t.Errorf("subjects = %v, want %v", got, tt.wantSubjects)
+			}
+
+			if got := SourcesOf(new.ObjectMeta); !reflect.DeepEqual(got, tt.wantSources) {
+				t.Errorf("sources = %v, want %v", got, tt.wantSources)
+			}
+
+			if got := provenanceOf(new.ObjectMeta); !reflect.DeepEqual(got, tt.wantProvenance) {
+				t.Errorf("provenance = %v, want %v", got, tt.wantProvenance)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package internal
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	v12 "k8s.io/api/core/v1"
+	v1 "k8s.io/api/rbac/v1"
+	"sort"
+	"strings"
+)
+
+const (
+	// AnnotationValueTKEAuthConfigMap is value of binding annotation set by mutating webhook if empty
+	AnnotationValueTKEAuthConfigMap = "true"
+)
+
+// NormalizeConfigMap returns copy of binding or user group configMap in canonical form, so that stored object is deterministic.
+// type of user is filled from defaultUserValueType, emails are lowercased, values are trimmed, users are sorted and deduplicated.
+// comments and other fields in yaml are kept.
+func NormalizeConfigMap(cfgMap *v12.ConfigMap) (*v12.ConfigMap, error) {
+	normalized := cfgMap.DeepCopy()
+
+	if value, ok := normalized.Annotations[AnnotationKeyTKEAuthConfigMap]; ok && value == "" {
+		normalized.Annotations[AnnotationKeyTKEAuthConfigMap] = AnnotationValueTKEAuthConfigMap
+	}
+
+	usersStr, ok := normalized.Data[DataKeyUsers]
+	if !ok {
+		return normalized, nil
+	}
+
+	doc := &yaml.Node{}
+	err := yaml.Unmarshal([]byte(usersStr), doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse users")
+	}
+
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return normalized, nil
+	}
+	root := doc.Content[0]
+
+	defaultUserValueType := ""
+	if node := mappingValue(root, "defaultUserValueType"); node != nil {
+		defaultUserValueType = node.Value
+	}
+
+	users := mappingValue(root, "users")
+	if users == nil || users.Kind != yaml.SequenceNode {
+		return normalized, nil
+	}
+
+	// renamed values, bindings referencing users by value should follow
+	renamed := normalizeUserNodes(users, defaultUserValueType)
+
+	buf, err := encodeYaml(doc)
+	if err != nil {
+		return nil, err
+	}
+	normalized.Data[DataKeyUsers] = buf
+
+	if bindingsStr, ok := normalized.Data[DataKeyBindings]; ok && len(renamed) > 0 {
+		buf, err := renameBindingEntryUsers(bindingsStr, renamed)
+		if err != nil {
+			return nil, err
+		}
+		normalized.Data[DataKeyBindings] = buf
+	}
+
+	return normalized, nil
+}
+
+// normalizeUserNodes normalizes each user in sequence node, then sorts and deduplicates them.
+// returns map of original value to normalized value, for changed values only.
+func normalizeUserNodes(users *yaml.Node, defaultUserValueType string) map[string]string {
+	renamed := make(map[string]string)
+
+	type keyedNode struct {
+		key  string
+		node *yaml.Node
+	}
+	nodes := make([]keyedNode, 0, len(users.Content))
+
+	for _, node := range users.Content {
+		if node.Kind != yaml.MappingNode {
+			nodes = append(nodes, keyedNode{key: node.Value, node: node})
+			continue
+		}
+
+		if group := mappingValue(node, "group"); group != nil {
+			group.Value = strings.TrimSpace(group.Value)
+			nodes = append(nodes, keyedNode{key: "group/" + group.Value, node: node})
+			continue
+		}
+
+		kind := scalarValue(node, "kind")
+		if kind == "" {
+			kind = v1.UserKind
+		}
+
+		if kind == v1.UserKind && scalarValue(node, "type") == "" && defaultUserValueType != "" {
+			setMappingValue(node, "type", defaultUserValueType)
+		}
+
+		if value := mappingValue(node, "value"); value != nil {
+			original := value.Value
+			value.Value = strings.TrimSpace(value.Value)
+			if kind == v1.UserKind && scalarValue(node, "type") == "email" {
+				value.Value = strings.ToLower(value.Value)
+			}
+
+			if value.Value != original {
+				renamed[original] = value.Value
+			}
+		}
+
+		key := strings.Join([]string{kind, scalarValue(node, "namespace"), scalarValue(node, "type"), scalarValue(node, "value"), scalarValue(node, "notBefore"), scalarValue(node, "expiresAt"), scheduleKey(node)}, "/")
+		nodes = append(nodes, keyedNode{key: key, node: node})
+	}
+
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].key < nodes[j].key
+	})
+
+	users.Content = make([]*yaml.Node, 0, len(nodes))
+	for i, node := range nodes {
+		if i > 0 && nodes[i-1].key == node.key {
+			continue
+		}
+		users.Content = append(users.Content, node.node)
+	}
+
+	return renamed
+}
+
+// renameBindingEntryUsers replaces values in users of binding entries with renamed values
+func renameBindingEntryUsers(bindingsStr string, renamed map[string]string) (string, error) {
+	doc := &yaml.Node{}
+	err := yaml.Unmarshal([]byte(bindingsStr), doc)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot parse bindings")
+	}
+
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.SequenceNode {
+		return bindingsStr, nil
+	}
+
+	for _, entry := range doc.Content[0].Content {
+		users := mappingValue(entry, "users")
+		if users == nil || users.Kind != yaml.SequenceNode {
+			continue
+		}
+
+		for _, user := range users.Content {
+			if value, ok := renamed[user.Value]; ok {
+				user.Value = value
+			}
+		}
+	}
+
+	return encodeYaml(doc)
+}
+
+func encodeYaml(doc *yaml.Node) (string, error) {
+	buf := &bytes.Buffer{}
+	encoder := yaml.NewEncoder(buf)
+	encoder.SetIndent(2)
+
+	err := encoder.Encode(doc)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot encode yaml")
+	}
+
+	return buf.String(), nil
+}
+
+// mappingValue returns value node of key in mapping node, nil if not found
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	return nil
+}
+
+// scheduleKey returns cron, duration, timezone of schedule in user node, used to distinguish users with different schedule
+func scheduleKey(node *yaml.Node) string {
+	schedule := mappingValue(node, "schedule")
+	if schedule == nil {
+		return ""
+	}
+
+	return strings.Join([]string{scalarValue(schedule, "cron"), scalarValue(schedule, "duration"), scalarValue(schedule, "timezone")}, "|")
+}
+
+func scalarValue(node *yaml.Node, key string) string {
+	if value := mappingValue(node, key); value != nil {
+		return value.Value
+	}
+
+	return ""
+}
+
+func setMappingValue(node *yaml.Node, key string, value string) {
+	node.Content = append(node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value},
+	)
+}
@@ -0,0 +1,151 @@
+package internal
+
+import (
+	v12 "k8s.io/api/core/v1"
+	v15 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+)
+
+func normalizeTestConfigMap(users string, bindings string) *v12.ConfigMap {
+	cfgMap := &v12.ConfigMap{
+		ObjectMeta: v15.ObjectMeta{
+			Name:        "binding",
+			Namespace:   "team-a",
+			Annotations: map[string]string{AnnotationKeyTKEAuthConfigMap: ""},
+		},
+		Data: map[string]string{
+			DataKeyBindingName: "team-a-view",
+			DataKeyRoleName:    "view",
+			DataKeyUsers:       users,
+		},
+	}
+
+	if bindings != "" {
+		cfgMap.Data[DataKeyBindings] = bindings
+	}
+
+	return cfgMap
+}
+
+const normalizeTestUsers = `defaultUserValueType: subAccountId
+users:
+  - value: "200020745367" # comment is kept
+  - type: email
+    value: " Do.Kim@PUBG.com "
+  - group: platform-team
+  - type: subAccountId
+    value: "200020745365"
+  - value: "200020745367"
+  - kind: Group
+    value: xtrm-platform-team
+`
+
+const normalizeTestBindings = `- bindingName: team-a-readonly
+  roleName: view
+  users:
+    - " Do.Kim@PUBG.com "
+    - "200020745365"
+`
+
+func TestNormalizeConfigMap(t *testing.T) {
+	normalized, err := NormalizeConfigMap(normalizeTestConfigMap(normalizeTestUsers, normalizeTestBindings))
+	if err != nil {
+		t.Fatalf("NormalizeConfigMap() returned error: %s", err)
+	}
+
+	if got := normalized.Annotations[AnnotationKeyTKEAuthConfigMap]; got != AnnotationValueTKEAuthConfigMap {
+		t.Errorf("binding annotation = %q, want %q", got, AnnotationValueTKEAuthConfigMap)
+	}
+
+	wantUsers := `defaultUserValueType: subAccountId
+users:
+  - kind: Group
+    value: xtrm-platform-team
+  - type: email
+    value: "do.kim@pubg.com"
+  - type: subAccountId
+    value: "200020745365"
+  - value: "200020745367" # comment is kept
+    type: subAccountId
+  - group: platform-team
+`
+	if got := normalized.Data[DataKeyUsers]; got != wantUsers {
+		t.Errorf("users =\n%s\nwant\n%s", got, wantUsers)
+	}
+
+	wantBindings := `- bindingName: team-a-readonly
+  roleName: view
+  users:
+    - "do.kim@pubg.com"
+    - "200020745365"
+`
+	if got := normalized.Data[DataKeyBindings]; got != wantBindings {
+		t.Errorf("bindings =\n%s\nwant\n%s", got, wantBindings)
+	}
+
+	// normalized configMap should be parsed to same users
+	tkeAuths, errs := ToTKEAuths(normalized)
+	if len(errs) > 0 {
+		t.Fatalf("normalized configMap cannot be parsed: %v", errs)
+	}
+	if len(tkeAuths) != 2 || len(tkeAuths[1].Users) != 2 {
+		t.Errorf("normalized configMap should have 2 bindings, and 2 users in second binding")
+	}
+}
+
+func TestNormalizeConfigMapIsIdempotent(t *testing.T) {
+	tests := []struct {
+		name     string
+		users    string
+		bindings string
+	}{
+		{"users and bindings", normalizeTestUsers, normalizeTestBindings},
+		{"users only", normalizeTestUsers, ""},
+		{"already normalized", "users:\n  - type: email\n    value: a@pubg.com\n", ""},
+		{"schedules are kept apart", `users:
+  - type: email
+    value: a@pubg.com
+    schedule:
+      cron: "0 9 * * *"
+      duration: 1h
+  - type: email
+    value: a@pubg.com
+    schedule:
+      cron: "0 18 * * *"
+      duration: 1h
+`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			once, err := NormalizeConfigMap(normalizeTestConfigMap(tt.users, tt.bindings))
+			if err != nil {
+				t.Fatalf("NormalizeConfigMap() returned error: %s", err)
+			}
+
+			twice, err := NormalizeConfigMap(once)
+			if err != nil {
+				t.Fatalf("NormalizeConfigMap() of normalized configMap returned error: %s", err)
+			}
+
+			for _, key := range []string{DataKeyUsers, DataKeyBindings} {
+				if once.Data[key] != twice.Data[key] {
+					t.Errorf("%s changed by second normalization:\n%s\nwant\n%s", key, twice.Data[key], once.Data[key])
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeConfigMapInvalidOrEmptyUsers(t *testing.T) {
+	if _, err := NormalizeConfigMap(normalizeTestConfigMap("users: [", "")); err == nil {
+		t.Errorf("NormalizeConfigMap() of invalid yaml should return error")
+	}
+
+	cfgMap := normalizeTestConfigMap("", "")
+	delete(cfgMap.Data, DataKeyUsers)
+	normalized, err := NormalizeConfigMap(cfgMap)
+	if err != nil || len(normalized.Data) != len(cfgMap.Data) {
+		t.Errorf("configMap without users should be kept as-is, err: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"github.com/pkg/errors"
+	v15 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"strings"
+)
+
+const (
+	// AnnotationKeySourceUID is UID of source object which binding is created from. merged binding has multiple UIDs joined by ","
+	AnnotationKeySourceUID = "tke-auth/source-uid"
+)
+
+// Owners is namespaces owning managed objects, key is same as conflict key of TKEAuth. eg: "ClusterRoleBinding/name"
+type Owners map[string]sets.String
+
+// namespacesOf returns namespaces of sources in source annotation, which own the object
+func namespacesOf(meta v15.ObjectMeta) sets.String {
+	namespaces := sets.NewString()
+
+	for _, source := range SourcesOf(meta) {
+		parts := strings.Split(source, "/")
+		if len(parts) == 3 {
+			namespaces.Insert(parts[1])
+		}
+	}
+
+	return namespaces
+}
+
+// addOwner records namespaces of object to owners. object without source annotation is not owned by any namespace
+func (owners Owners) addOwner(key string, meta v15.ObjectMeta) {
+	namespaces := namespacesOf(meta)
+	if namespaces.Len() == 0 {
+		return
+	}
+
+	owners[key] = namespaces
+}
+
+// mergeSourceUIDs sets union of source UIDs of metas to dst
+func mergeSourceUIDs(dst *v15.ObjectMeta, metas []v15.ObjectMeta) {
+	uids := sets.NewString()
+	for _, meta := range metas {
+		if value := meta.Annotations[AnnotationKeySourceUID]; value != "" {
+			uids.Insert(strings.Split(value, ",")...)
+		}
+	}
+
+	if dst.Annotations == nil {
+		dst.Annotations = map[string]string{}
+	}
+	dst.Annotations[AnnotationKeySourceUID] = strings.Join(uids.List(), ",")
+}
+
+// CheckOwnership finds TKEAuths claiming objects owned by another namespace.
+// a source cannot take over object created from source of other namespace, even if the object is managed by controller.
+// returns errors of rejected sources, key is SourceKey of source.
+func CheckOwnership(tkeAuths []*TKEAuth, owners Owners) map[string]error {
+	rejected := make(map[string]error)
+
+	for _, tkeAuth := range tkeAuths {
+		sourceKey := SourceKey(tkeAuth.Source)
+		if _, ok := rejected[sourceKey]; ok { // report first rejection only
+			continue
+		}
+
+		for _, key := range tkeAuth.conflictKeys() {
+			namespaces, ok := owners[key]
+			if !ok || namespaces.Has(tkeAuth.Source.Namespace) {
+				continue
+			}
+
+			rejected[sourceKey] = errors.Errorf("%s is owned by namespace %s, cannot be taken over by source of namespace %s", key, strings.Join(namespaces.List(), ", "), tkeAuth.Source.Namespace)
+			break
+		}
+	}
+
+	return rejected
+}
+
+// CheckNamespacePrefix returns error if name of cluster-scoped object created from TKEAuth does not start with "<namespace of source>-".
+// names of RoleBindings are not checked, since RoleBinding is scoped by namespace.
+func (t *TKEAuth) CheckNamespacePrefix() error {
+	prefix := t.Source.Namespace + "-"
+
+	if !t.IsNamespaced() && !strings.HasPrefix(t.BindingName, prefix) {
+		return errors.Errorf("binding: %s, name of ClusterRoleBinding should start with %s", t.BindingName, prefix)
+	}
+
+	if t.HasRules() && !strings.HasPrefix(t.RoleName, prefix) {
+		return errors.Errorf("binding: %s, name of ClusterRole %s should start with %s", t.BindingName, t.RoleName, prefix)
+	}
+
+	return nil
+}
+
+// Owners returns namespaces owning managed ClusterRoleBindings
+func (TKEAuthCRB *TKEAuthClusterRoleBindings) Owners() (Owners, error) {
+	CRBs, err := TKEAuthCRB.getClusterRoleBindings()
+	if err != nil {
+		return nil, err
+	}
+
+	owners := make(Owners)
+	for _, crb := range CRBs {
+		owners.addOwner("ClusterRoleBinding/"+crb.Name, crb.ObjectMeta)
+	}
+
+	return owners, nil
+}
+
+// Owners returns namespaces owning managed RoleBindings
+func (TKEAuthRB *TKEAuthRoleBindings) Owners() (Owners, error) {
+	RBs, err := TKEAuthRB.getRoleBindings()
+	if err != nil {
+		return nil, err
+	}
+
+	owners := make(Owners)
+	for _, rb := range RBs {
+		owners.addOwner("RoleBinding/"+roleBindingKey(rb), rb.ObjectMeta)
+	}
+
+	return owners, nil
+}
+
+// Owners returns namespaces owning managed ClusterRoles
+func (roles *TKEAuthRoles) Owners() (Owners, error) {
+	CRs, err := roles.getClusterRoles()
+	if err != nil {
+		return nil, err
+	}
+
+	owners := make(Owners)
+	for _, cr := range CRs {
+		owners.addOwner("ClusterRole/"+cr.Name, cr.ObjectMeta)
+	}
+
+	return owners, nil
+}
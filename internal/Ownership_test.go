@@ -0,0 +1,99 @@
+package internal
+
+import (
+	v12 "k8s.io/api/core/v1"
+	v15 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// ownershipTestMeta returns meta of managed object created from sources
+func ownershipTestMeta(name string, sources string) v15.ObjectMeta {
+	meta := v15.ObjectMeta{Name: name, Annotations: map[string]string{AnnotationKeyManagedTKEAuthCRB: AnnotationValueManagedTKEAuthCRB}}
+	if sources != "" {
+		meta.Annotations[AnnotationKeySource] = sources
+	}
+
+	return meta
+}
+
+func TestCheckOwnership(t *testing.T) {
+	owners := make(Owners)
+	owners.addOwner("ClusterRoleBinding/team-a-view", ownershipTestMeta("team-a-view", "ConfigMap/team-a/binding"))
+	owners.addOwner("ClusterRoleBinding/shared-view", ownershipTestMeta("shared-view", "ConfigMap/team-a/binding,Secret/team-b/binding"))
+	owners.addOwner("ClusterRoleBinding/legacy-view", ownershipTestMeta("legacy-view", ""))
+	owners.addOwner("RoleBinding/team-a/edit", ownershipTestMeta("edit", "ConfigMap/team-a/binding"))
+	owners.addOwner("ClusterRole/team-a-custom", ownershipTestMeta("team-a-custom", "ConfigMap/team-a/binding"))
+
+	tkeAuth := func(namespace string, bindingName string, namespaces ...string) *TKEAuth {
+		return &TKEAuth{
+			BindingName: bindingName,
+			RoleKind:    "ClusterRole",
+			RoleName:    "view",
+			Namespaces:  namespaces,
+			Source:      v12.ObjectReference{Kind: "ConfigMap", Namespace: namespace, Name: "binding"},
+		}
+	}
+	withRole := func(tkeAuth *TKEAuth, roleName string) *TKEAuth {
+		tkeAuth.RoleName = roleName
+		tkeAuth.Rules = []Rule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}
+		return tkeAuth
+	}
+
+	tests := []struct {
+		name         string
+		tkeAuths     []*TKEAuth
+		wantRejected []string
+	}{
+		{"object owned by namespace of source", []*TKEAuth{tkeAuth("team-a", "team-a-view")}, []string{}},
+		{"object owned by foreign namespace", []*TKEAuth{tkeAuth("team-b", "team-a-view")}, []string{"ConfigMap/team-b/binding"}},
+		{"merged object owned by every namespace of sources", []*TKEAuth{tkeAuth("team-a", "shared-view"), tkeAuth("team-b", "shared-view"), tkeAuth("team-c", "shared-view")}, []string{"ConfigMap/team-c/binding"}},
+		{"object without source annotation is claimable", []*TKEAuth{tkeAuth("team-b", "legacy-view")}, []string{}},
+		{"new object is claimable", []*TKEAuth{tkeAuth("team-b", "team-b-view")}, []string{}},
+		{"RoleBinding owned by foreign namespace", []*TKEAuth{tkeAuth("team-b", "edit", "team-b", "team-a")}, []string{"ConfigMap/team-b/binding"}},
+		{"ClusterRole owned by foreign namespace", []*TKEAuth{withRole(tkeAuth("team-b", "team-b-view"), "team-a-custom")}, []string{"ConfigMap/team-b/binding"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rejected := CheckOwnership(tt.tkeAuths, owners)
+
+			got := make([]string, 0)
+			for sourceKey := range rejected {
+				got = append(got, sourceKey)
+			}
+			sort.Strings(got)
+
+			if !reflect.DeepEqual(got, tt.wantRejected) {
+				t.Errorf("rejected = %v, want %v", got, tt.wantRejected)
+			}
+		})
+	}
+}
+
+func TestCheckNamespacePrefix(t *testing.T) {
+	tests := []struct {
+		name    string
+		tkeAuth *TKEAuth
+		wantErr bool
+	}{
+		{"ClusterRoleBinding with prefix", &TKEAuth{BindingName: "team-a-view", RoleName: "view"}, false},
+		{"ClusterRoleBinding without prefix", &TKEAuth{BindingName: "view", RoleName: "view"}, true},
+		{"ClusterRoleBinding with prefix of other namespace", &TKEAuth{BindingName: "team-ab-view", RoleName: "view"}, true},
+		{"RoleBinding is not checked", &TKEAuth{BindingName: "view", RoleName: "view", Namespaces: []string{"team-a"}}, false},
+		{"ClusterRole from rules without prefix", &TKEAuth{BindingName: "team-a-custom", RoleName: "custom", Rules: []Rule{{Verbs: []string{"get"}}}}, true},
+		{"ClusterRole from rules with prefix", &TKEAuth{BindingName: "team-a-custom", RoleName: "team-a-custom", Rules: []Rule{{Verbs: []string{"get"}}}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.tkeAuth.Source = v12.ObjectReference{Kind: "ConfigMap", Namespace: "team-a", Name: "binding"}
+
+			err := tt.tkeAuth.CheckNamespacePrefix()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckNamespacePrefix() = %v, wantErr %t", err, tt.wantErr)
+			}
+		})
+	}
+}
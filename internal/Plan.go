@@ -0,0 +1,165 @@
+package internal
+
+import (
+	v14 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	v15 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sort"
+)
+
+// SyncPlan is report of changes a sync applies, used in dry-run mode
+type SyncPlan struct {
+	Additions []PlannedChange `json:"additions"`
+	Updates   []PlannedChange `json:"updates"`
+	Deletions []PlannedChange `json:"deletions"`
+	// Refused is error of DeletionGuard, the sync is refused if not empty
+	Refused string `json:"refused,omitempty"`
+}
+
+// PlannedChange is change of ClusterRoleBinding, RoleBinding or ClusterRole
+type PlannedChange struct {
+	Kind      string   `json:"kind"`
+	Namespace string   `json:"namespace,omitempty"`
+	Name      string   `json:"name"`
+	Sources   []string `json:"sources,omitempty"`
+	// RoleRef is "Kind/name" of role bound by binding
+	RoleRef string `json:"roleRef,omitempty"`
+	// PreviousRoleRef is set if binding is recreated to bind another role
+	PreviousRoleRef string   `json:"previousRoleRef,omitempty"`
+	AddedSubjects   []string `json:"addedSubjects,omitempty"`
+	RemovedSubjects []string `json:"removedSubjects,omitempty"`
+	// RulesChanged is set if rules or labels of ClusterRole are changed
+	RulesChanged bool `json:"rulesChanged,omitempty"`
+}
+
+// NewSyncPlan returns report of plans. updates without any change are not reported
+func NewSyncPlan(crPlan *ClusterRolePlan, crbPlan *ClusterRoleBindingPlan, rbPlan *RoleBindingPlan) *SyncPlan {
+	plan := &SyncPlan{
+		Additions: make([]PlannedChange, 0),
+		Updates:   make([]PlannedChange, 0),
+		Deletions: make([]PlannedChange, 0),
+	}
+
+	for _, cr := range crPlan.Additions {
+		plan.Additions = append(plan.Additions, clusterRoleChange(cr.ObjectMeta))
+	}
+	for _, cr := range crPlan.Updates {
+		old := crPlan.old[cr.Name]
+		if !equality.Semantic.DeepEqual(old.Rules, cr.Rules) || !equality.Semantic.DeepEqual(old.Labels, cr.Labels) {
+			change := clusterRoleChange(cr.ObjectMeta)
+			change.RulesChanged = true
+			plan.Updates = append(plan.Updates, change)
+		}
+	}
+	for _, cr := range crPlan.Deletions {
+		plan.Deletions = append(plan.Deletions, clusterRoleChange(cr.ObjectMeta))
+	}
+
+	for _, crb := range crbPlan.Additions {
+		plan.Additions = append(plan.Additions, bindingChange("ClusterRoleBinding", crb.ObjectMeta, crb.RoleRef, nil, nil, crb.Subjects))
+	}
+	for _, crb := range append(crbPlan.Updates, crbPlan.Recreations...) {
+		old := crbPlan.old[crb.Name]
+		if change := bindingChange("ClusterRoleBinding", crb.ObjectMeta, crb.RoleRef, &old.RoleRef, old.Subjects, crb.Subjects); change.isChanged() {
+			plan.Updates = append(plan.Updates, change)
+		}
+	}
+	for _, crb := range crbPlan.Releases {
+		old := crbPlan.old[crb.Name]
+		plan.Updates = append(plan.Updates, bindingChange("ClusterRoleBinding", old.ObjectMeta, crb.RoleRef, nil, old.Subjects, crb.Subjects))
+	}
+	for _, crb := range crbPlan.Deletions {
+		plan.Deletions = append(plan.Deletions, bindingChange("ClusterRoleBinding", crb.ObjectMeta, crb.RoleRef, nil, crb.Subjects, nil))
+	}
+
+	for _, rb := range rbPlan.Additions {
+		plan.Additions = append(plan.Additions, bindingChange("RoleBinding", rb.ObjectMeta, rb.RoleRef, nil, nil, rb.Subjects))
+	}
+	for _, rb := range append(rbPlan.Updates, rbPlan.Recreations...) {
+		old := rbPlan.old[roleBindingKey(rb)]
+		if change := bindingChange("RoleBinding", rb.ObjectMeta, rb.RoleRef, &old.RoleRef, old.Subjects, rb.Subjects); change.isChanged() {
+			plan.Updates = append(plan.Updates, change)
+		}
+	}
+	for _, rb := range rbPlan.Releases {
+		old := rbPlan.old[roleBindingKey(rb)]
+		plan.Updates = append(plan.Updates, bindingChange("RoleBinding", old.ObjectMeta, rb.RoleRef, nil, old.Subjects, rb.Subjects))
+	}
+	for _, rb := range rbPlan.Deletions {
+		plan.Deletions = append(plan.Deletions, bindingChange("RoleBinding", rb.ObjectMeta, rb.RoleRef, nil, rb.Subjects, nil))
+	}
+
+	for _, changes := range [][]PlannedChange{plan.Additions, plan.Updates, plan.Deletions} {
+		sortChanges(changes)
+	}
+
+	return plan
+}
+
+func (c PlannedChange) isChanged() bool {
+	return c.PreviousRoleRef != "" || len(c.AddedSubjects) > 0 || len(c.RemovedSubjects) > 0
+}
+
+func clusterRoleChange(meta v15.ObjectMeta) PlannedChange {
+	return PlannedChange{
+		Kind:    "ClusterRole",
+		Name:    meta.Name,
+		Sources: SourcesOf(meta),
+	}
+}
+
+// bindingChange returns change of binding from old subjects to new subjects. previousRoleRef is reported if it is not same as roleRef
+func bindingChange(kind string, meta v15.ObjectMeta, roleRef v14.RoleRef, previousRoleRef *v14.RoleRef, oldSubjects, newSubjects []v14.Subject) PlannedChange {
+	oldKeys := sets.NewString()
+	for _, subject := range oldSubjects {
+		oldKeys.Insert(subjectString(subject))
+	}
+
+	newKeys := sets.NewString()
+	for _, subject := range newSubjects {
+		newKeys.Insert(subjectString(subject))
+	}
+
+	change := PlannedChange{
+		Kind:            kind,
+		Namespace:       meta.Namespace,
+		Name:            meta.Name,
+		Sources:         SourcesOf(meta),
+		RoleRef:         roleRefString(roleRef),
+		AddedSubjects:   newKeys.Difference(oldKeys).List(),
+		RemovedSubjects: oldKeys.Difference(newKeys).List(),
+	}
+
+	if previousRoleRef != nil && *previousRoleRef != roleRef {
+		change.PreviousRoleRef = roleRefString(*previousRoleRef)
+	}
+
+	return change
+}
+
+// subjectString returns "Kind/name", or "Kind/namespace/name" for ServiceAccount
+func subjectString(subject v14.Subject) string {
+	if subject.Namespace == "" {
+		return subject.Kind + "/" + subject.Name
+	}
+
+	return subject.Kind + "/" + subject.Namespace + "/" + subject.Name
+}
+
+func roleRefString(roleRef v14.RoleRef) string {
+	return roleRef.Kind + "/" + roleRef.Name
+}
+
+func sortChanges(changes []PlannedChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+}
@@ -0,0 +1,230 @@
+package internal
+
+import (
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	v12 "k8s.io/api/core/v1"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	// DataKeyPolicy is key of policy in policy configMap
+	DataKeyPolicy = "policy"
+)
+
+// Policy decides which ClusterRoles can be bound by sources of each namespace.
+// source of namespace not in any rule cannot bind any ClusterRole.
+type Policy struct {
+	Rules []PolicyRule `yaml:"rules"`
+}
+
+// PolicyRule allows sources of Namespaces to bind ClusterRoles
+type PolicyRule struct {
+	// Namespaces is namespaces of source, supports wildcard. eg: "*", "team-*"
+	Namespaces []string `yaml:"namespaces"`
+	// ClusterRoles is names of ClusterRole allowed to bind, supports wildcard like Namespaces
+	ClusterRoles []string `yaml:"clusterRoles"`
+	// TargetNamespaces is namespaces allowed to create RoleBindings in, supports wildcard like Namespaces.
+	// only namespace of source is allowed if empty
+	TargetNamespaces []string `yaml:"targetNamespaces"`
+	// AllowRules allows creating ClusterRole from rules of binding, name of the ClusterRole should be in ClusterRoles
+	AllowRules bool `yaml:"allowRules"`
+	// AllowAggregation allows aggregationLabels on ClusterRole created from rules,
+	// which adds the rules to other ClusterRoles. eg: rbac.authorization.k8s.io/aggregate-to-admin
+	AllowAggregation bool `yaml:"allowAggregation"`
+	// AllowAdopt allows taking over existing unmanaged bindings of ClusterRoles with adopt overwrite or merge.
+	// RoleBindings are adopted only in namespaces allowed by TargetNamespaces, like they are created
+	AllowAdopt bool `yaml:"allowAdopt"`
+}
+
+// allowsTargetNamespaces returns true if RoleBindings of every namespace can be created by source of sourceNamespace
+func (r *PolicyRule) allowsTargetNamespaces(sourceNamespace string, namespaces []string) bool {
+	for _, namespace := range namespaces {
+		if len(r.TargetNamespaces) == 0 && namespace != sourceNamespace {
+			return false
+		}
+		if len(r.TargetNamespaces) > 0 && !matchesPolicyValue(r.TargetNamespaces, namespace) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ParsePolicy returns Policy from yaml
+func ParsePolicy(buf []byte) (*Policy, error) {
+	policy := &Policy{}
+
+	err := yaml.Unmarshal(buf, policy)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse policy")
+	}
+
+	return policy, nil
+}
+
+// matchesPolicyValue returns true if value matches any pattern. invalid pattern matches nothing
+func matchesPolicyValue(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, value); err == nil && ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check returns error if source of TKEAuth is not allowed to bind its role. nil policy allows everything.
+// Role in namespace of source is always allowed, Role in other namespaces should be allowed by TargetNamespaces of any rule.
+func (p *Policy) Check(t *TKEAuth) error {
+	if p == nil {
+		return nil
+	}
+
+	if t.RoleKind == "Role" {
+		return p.checkRole(t)
+	}
+
+	for _, rule := range p.Rules {
+		if !matchesPolicyValue(rule.Namespaces, t.Source.Namespace) || !matchesPolicyValue(rule.ClusterRoles, t.RoleName) {
+			continue
+		}
+
+		if !rule.allowsTargetNamespaces(t.Source.Namespace, t.Namespaces) {
+			continue
+		}
+
+		if t.HasRules() && !rule.AllowRules {
+			continue
+		}
+
+		if t.HasRules() && len(t.AggregationLabels) > 0 && !rule.AllowAggregation {
+			continue
+		}
+
+		return nil
+	}
+
+	if t.HasRules() && len(t.AggregationLabels) > 0 {
+		return errors.Errorf("binding: %s, source of namespace %s is not allowed to create ClusterRole %s with aggregationLabels by policy", t.BindingName, t.Source.Namespace, t.RoleName)
+	}
+
+	if t.HasRules() {
+		return errors.Errorf("binding: %s, source of namespace %s is not allowed to create ClusterRole %s by policy", t.BindingName, t.Source.Namespace, t.RoleName)
+	}
+
+	if t.IsNamespaced() {
+		return errors.Errorf("binding: %s, source of namespace %s is not allowed to bind ClusterRole %s in namespaces %s by policy", t.BindingName, t.Source.Namespace, t.RoleName, strings.Join(t.Namespaces, ", "))
+	}
+
+	return errors.Errorf("binding: %s, source of namespace %s is not allowed to bind ClusterRole %s by policy", t.BindingName, t.Source.Namespace, t.RoleName)
+}
+
+// checkRole returns error if source of TKEAuth is not allowed to bind Role in its namespaces
+func (p *Policy) checkRole(t *TKEAuth) error {
+	// rule without TargetNamespaces allows only namespace of source
+	if (&PolicyRule{}).allowsTargetNamespaces(t.Source.Namespace, t.Namespaces) {
+		return nil
+	}
+
+	for _, rule := range p.Rules {
+		if matchesPolicyValue(rule.Namespaces, t.Source.Namespace) && len(rule.TargetNamespaces) > 0 && rule.allowsTargetNamespaces(t.Source.Namespace, t.Namespaces) {
+			return nil
+		}
+	}
+
+	return errors.Errorf("binding: %s, source of namespace %s is not allowed to bind Role %s in namespaces %s by policy", t.BindingName, t.Source.Namespace, t.RoleName, strings.Join(t.Namespaces, ", "))
+}
+
+// CheckAdopt returns error if source of TKEAuth is not allowed to take over existing unmanaged bindings. nil policy allows everything.
+func (p *Policy) CheckAdopt(t *TKEAuth) error {
+	if p == nil {
+		return nil
+	}
+
+	for _, rule := range p.Rules {
+		if !rule.AllowAdopt || !matchesPolicyValue(rule.Namespaces, t.Source.Namespace) || !rule.allowsTargetNamespaces(t.Source.Namespace, t.Namespaces) {
+			continue
+		}
+
+		if t.RoleKind == "Role" || matchesPolicyValue(rule.ClusterRoles, t.RoleName) {
+			return nil
+		}
+	}
+
+	return errors.Errorf("binding: %s, source of namespace %s is not allowed to adopt existing binding of %s %s by policy", t.BindingName, t.Source.Namespace, t.RoleKind, t.RoleName)
+}
+
+// PolicySource loads Policy from file or configMap, policy is reloaded on every sync
+type PolicySource struct {
+	file string
+
+	cmNamespace string
+	cmName      string
+	cmLister    listersv1.ConfigMapLister
+}
+
+// NewPolicySource returns PolicySource of file or configMap of "namespace/name". policy is disabled if both are empty.
+func NewPolicySource(file string, configMap string, cmLister listersv1.ConfigMapLister) (*PolicySource, error) {
+	if file != "" && configMap != "" {
+		return nil, errors.New("only one of policy file and policy configMap can be provided")
+	}
+
+	source := &PolicySource{
+		file:     file,
+		cmLister: cmLister,
+	}
+
+	if configMap != "" {
+		namespace, name, err := cache.SplitMetaNamespaceKey(configMap)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid policy configMap: %s", configMap)
+		}
+		if namespace == "" {
+			return nil, errors.Errorf("namespace of policy configMap %s is empty, should be namespace/name", configMap)
+		}
+
+		source.cmNamespace = namespace
+		source.cmName = name
+	}
+
+	return source, nil
+}
+
+// Enabled returns true if policy file or configMap is provided
+func (s *PolicySource) Enabled() bool {
+	return s.file != "" || s.cmName != ""
+}
+
+// IsPolicyConfigMap returns true if configMap is the policy configMap
+func (s *PolicySource) IsPolicyConfigMap(cfgMap *v12.ConfigMap) bool {
+	return s.cmName != "" && cfgMap.Namespace == s.cmNamespace && cfgMap.Name == s.cmName
+}
+
+// Load returns current Policy, nil if policy is disabled.
+// returns error if policy cannot be loaded, caller should not apply bindings without policy.
+func (s *PolicySource) Load() (*Policy, error) {
+	if s.file != "" {
+		buf, err := os.ReadFile(s.file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot read policy file %s", s.file)
+		}
+
+		return ParsePolicy(buf)
+	}
+
+	if s.cmName != "" {
+		cfgMap, err := s.cmLister.ConfigMaps(s.cmNamespace).Get(s.cmName)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot get policy configMap %s/%s", s.cmNamespace, s.cmName)
+		}
+
+		return ParsePolicy([]byte(cfgMap.Data[DataKeyPolicy]))
+	}
+
+	return nil, nil
+}
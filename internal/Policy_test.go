@@ -0,0 +1,80 @@
+package internal
+
+import (
+	v12 "k8s.io/api/core/v1"
+	"testing"
+)
+
+// policyTestTKEAuth returns binding of role from configMap in namespace, RoleBindings are created in namespaces if provided
+func policyTestTKEAuth(namespace string, roleKind string, roleName string, namespaces ...string) *TKEAuth {
+	return &TKEAuth{
+		BindingName: namespace + "-binding",
+		RoleKind:    roleKind,
+		RoleName:    roleName,
+		Namespaces:  namespaces,
+		Source:      v12.ObjectReference{Kind: "ConfigMap", Namespace: namespace, Name: "binding"},
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	policy, err := ParsePolicy([]byte(`
+rules:
+  - namespaces: ["*"]
+    clusterRoles: ["view"]
+  - namespaces: ["team-*"]
+    clusterRoles: ["team-*-reader"]
+  - namespaces: ["team-a"]
+    clusterRoles: ["edit"]
+  - namespaces: ["team-a"]
+    clusterRoles: ["admin"]
+    targetNamespaces: ["team-a-*"]
+  - namespaces: ["team-a"]
+    clusterRoles: ["team-a-custom"]
+    allowRules: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withRules := func(tkeAuth *TKEAuth) *TKEAuth {
+		tkeAuth.Rules = []Rule{{Verbs: []string{"get"}, APIGroups: []string{""}, Resources: []string{"pods"}}}
+		return tkeAuth
+	}
+	withAggregation := func(tkeAuth *TKEAuth) *TKEAuth {
+		tkeAuth.AggregationLabels = map[string]string{"rbac.authorization.k8s.io/aggregate-to-view": "true"}
+		return tkeAuth
+	}
+
+	tests := []struct {
+		name    string
+		policy  *Policy
+		tkeAuth *TKEAuth
+		wantErr bool
+	}{
+		{"nil policy allows everything", nil, policyTestTKEAuth("other", "ClusterRole", "cluster-admin"), false},
+		{"wildcard namespace", policy, policyTestTKEAuth("other", "ClusterRole", "view"), false},
+		{"wildcard namespace does not allow other role", policy, policyTestTKEAuth("other", "ClusterRole", "edit"), true},
+		{"wildcard role", policy, policyTestTKEAuth("team-b", "ClusterRole", "team-b-reader"), false},
+		{"wildcard role of unmatched namespace", policy, policyTestTKEAuth("other", "ClusterRole", "team-b-reader"), true},
+		{"role not in any rule", policy, policyTestTKEAuth("team-a", "ClusterRole", "cluster-admin"), true},
+		{"empty targetNamespaces allows namespace of source", policy, policyTestTKEAuth("team-a", "ClusterRole", "edit", "team-a"), false},
+		{"empty targetNamespaces denies other namespace", policy, policyTestTKEAuth("team-a", "ClusterRole", "edit", "team-a", "team-b"), true},
+		{"targetNamespaces allows matching namespaces", policy, policyTestTKEAuth("team-a", "ClusterRole", "admin", "team-a-dev", "team-a-prod"), false},
+		{"targetNamespaces denies unmatched namespace", policy, policyTestTKEAuth("team-a", "ClusterRole", "admin", "team-a-dev", "team-b"), true},
+		{"Role in namespace of source", policy, policyTestTKEAuth("other", "Role", "reader", "other"), false},
+		{"Role in foreign namespace", policy, policyTestTKEAuth("team-b", "Role", "reader", "team-a"), true},
+		{"Role in namespace allowed by targetNamespaces", policy, policyTestTKEAuth("team-a", "Role", "reader", "team-a-dev"), false},
+		{"allowRules", policy, withRules(policyTestTKEAuth("team-a", "ClusterRole", "team-a-custom")), false},
+		{"allowRules without allowAggregation", policy, withAggregation(withRules(policyTestTKEAuth("team-a", "ClusterRole", "team-a-custom"))), true},
+		{"rules without allowRules", policy, withRules(policyTestTKEAuth("team-a", "ClusterRole", "edit")), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.tkeAuth)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Check() = %v, wantErr %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package internal
+
+import (
+	"context"
+	"example.com/tke-auth-controller/log"
+	"github.com/pkg/errors"
+	"github.com/thoas/go-funk"
+	v14 "k8s.io/api/rbac/v1"
+	v15 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	v1 "k8s.io/client-go/informers/rbac/v1"
+	v13 "k8s.io/client-go/kubernetes/typed/rbac/v1"
+	v12 "k8s.io/client-go/listers/rbac/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"strings"
+)
+
+// TKEAuthRoles checks ClusterRole or Role referenced by TKEAuth exists,
+// and manages ClusterRoles created from rules of TKEAuth
+type TKEAuthRoles struct {
+	ClusterRoleInformer v1.ClusterRoleInformer
+	ClusterRoleLister   v12.ClusterRoleLister
+	RoleInformer        v1.RoleInformer
+	RoleLister          v12.RoleLister
+	ClusterRoleSynced   cache.InformerSynced
+	RoleSynced          cache.InformerSynced
+
+	crIface v13.ClusterRoleInterface
+
+	stopCh <-chan struct{}
+}
+
+func NewTKEAuthRoles(clusterRoleInformer v1.ClusterRoleInformer, clusterRoleLister v12.ClusterRoleLister, roleInformer v1.RoleInformer, roleLister v12.RoleLister, crIface v13.ClusterRoleInterface, stopCh <-chan struct{}) *TKEAuthRoles {
+	roles := &TKEAuthRoles{
+		ClusterRoleInformer: clusterRoleInformer,
+		ClusterRoleLister:   clusterRoleLister,
+		RoleInformer:        roleInformer,
+		RoleLister:          roleLister,
+		ClusterRoleSynced:   clusterRoleInformer.Informer().HasSynced,
+		RoleSynced:          roleInformer.Informer().HasSynced,
+		crIface:             crIface,
+		stopCh:              stopCh,
+	}
+
+	return roles
+}
+
+// CheckRoleRefExists returns error if ClusterRole of TKEAuth, or Role in any namespace of TKEAuth does not exist.
+// if TKEAuth has rules, returns error if ClusterRole of same name exists but not managed by controller.
+func (roles *TKEAuthRoles) CheckRoleRefExists(tkeAuth *TKEAuth) error {
+	roles.waitUntilCacheSync()
+
+	if tkeAuth.HasRules() {
+		cr, err := roles.ClusterRoleLister.Get(tkeAuth.RoleName)
+		if err == nil {
+			if _, ok := cr.Annotations[AnnotationKeyManagedTKEAuthCRB]; !ok {
+				return errors.Errorf("binding: %s, ClusterRole %s already exists and not managed by TKE-Auth controller", tkeAuth.BindingName, tkeAuth.RoleName)
+			}
+		}
+
+		return nil
+	}
+
+	if tkeAuth.RoleKind == "Role" {
+		for _, namespace := range tkeAuth.Namespaces {
+			_, err := roles.RoleLister.Roles(namespace).Get(tkeAuth.RoleName)
+			if err != nil {
+				return errors.Wrapf(err, "binding: %s, cannot find Role %s in namespace %s", tkeAuth.BindingName, tkeAuth.RoleName, namespace)
+			}
+		}
+
+		return nil
+	}
+
+	_, err := roles.ClusterRoleLister.Get(tkeAuth.RoleName)
+	if err != nil {
+		return errors.Wrapf(err, "binding: %s, cannot find ClusterRole %s", tkeAuth.BindingName, tkeAuth.RoleName)
+	}
+
+	return nil
+}
+
+// ClusterRolePlan is changes of ClusterRoles to apply newCRs, see PlanClusterRoles
+type ClusterRolePlan struct {
+	Additions []*v14.ClusterRole
+	Updates   []*v14.ClusterRole
+	Deletions []*v14.ClusterRole
+	// Managed is number of managed ClusterRoles before plan is applied
+	Managed int
+
+	// old is managed ClusterRoles before plan is applied, key is name
+	old map[string]*v14.ClusterRole
+}
+
+// PlanClusterRoles returns changes to create, update ClusterRoles created from rules and delete managed ClusterRoles not in newCRs.
+// ClusterRoles created from skipSources are kept untouched, unless newCRs has ClusterRole of same name.
+func (roles *TKEAuthRoles) PlanClusterRoles(newCRs []*v14.ClusterRole, skipSources sets.String) (*ClusterRolePlan, error) {
+	roles.waitUntilCacheSync()
+
+	CRs, err := roles.getClusterRoles()
+	if err != nil {
+		return nil, err
+	}
+
+	claimed := sets.NewString()
+	for _, new := range newCRs {
+		claimed.Insert(new.Name)
+	}
+
+	oldCRs := make([]*v14.ClusterRole, 0)
+	for _, cr := range CRs {
+		// object claimed by another source is not skipped, the other source takes it over
+		if isCreatedFromSources(cr.ObjectMeta, skipSources) && !claimed.Has(cr.Name) {
+			klog.V(log.VerboseLevel).Infof("skipping ClusterRole %s, source %s is failed to sync.\n", cr.Name, cr.Annotations[AnnotationKeySource])
+			continue
+		}
+
+		oldCRs = append(oldCRs, cr)
+	}
+
+	plan := &ClusterRolePlan{
+		Additions: differenceClusterRoles(newCRs, oldCRs),
+		Updates:   getClusterRoleUpdates(newCRs, oldCRs),
+		Deletions: differenceClusterRoles(oldCRs, newCRs),
+		Managed:   len(CRs),
+		old:       make(map[string]*v14.ClusterRole),
+	}
+	for _, cr := range oldCRs {
+		plan.old[cr.Name] = cr
+	}
+
+	return plan, nil
+}
+
+// ApplyClusterRoles applies changes of plan
+func (roles *TKEAuthRoles) ApplyClusterRoles(plan *ClusterRolePlan) error {
+	deletions, additions, updates := plan.Deletions, plan.Additions, plan.Updates
+	klog.Infof("ClusterRole changed. add: %d, update: %d, delete: %d\n", len(additions), len(updates), len(deletions))
+
+	klog.Infof("added ClusterRoles: %s\n", strings.Join(funk.Map(additions, func(cr *v14.ClusterRole) string { return cr.Name }).([]string), ", "))
+	klog.Infof("updated ClusterRoles: %s\n", strings.Join(funk.Map(updates, func(cr *v14.ClusterRole) string { return cr.Name }).([]string), ", "))
+	klog.Infof("deleted ClusterRoles: %s\n", strings.Join(funk.Map(deletions, func(cr *v14.ClusterRole) string { return cr.Name }).([]string), ", "))
+
+	for _, cr := range deletions {
+		err := roles.crIface.Delete(context.TODO(), cr.Name, v15.DeleteOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, cr := range additions {
+		cr.Annotations[AnnotationKeyManagedTKEAuthCRB] = AnnotationValueManagedTKEAuthCRB
+		_, err := roles.crIface.Create(context.TODO(), cr, v15.CreateOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	return roles.updateClusterRoles(updates)
+}
+
+func (roles *TKEAuthRoles) updateClusterRoles(CRs []*v14.ClusterRole) error {
+	for _, cr := range CRs {
+		_, err := roles.crIface.Update(context.TODO(), cr, v15.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// differenceClusterRoles returns A - B in set, key is Name
+func differenceClusterRoles(a, b []*v14.ClusterRole) []*v14.ClusterRole {
+	aSet := make(map[string]*v14.ClusterRole)
+
+	for _, cr := range a {
+		aSet[cr.Name] = cr
+	}
+
+	for _, cr := range b {
+		delete(aSet, cr.Name)
+	}
+
+	arr := make([]*v14.ClusterRole, 0)
+	for _, val := range aSet {
+		arr = append(arr, val)
+	}
+
+	return arr
+}
+
+func getClusterRoleUpdates(new, old []*v14.ClusterRole) []*v14.ClusterRole {
+	oldSet := map[string]*v14.ClusterRole{}
+
+	for _, cr := range old {
+		oldSet[cr.Name] = cr
+	}
+
+	updates := make([]*v14.ClusterRole, 0)
+
+	for _, newCr := range new {
+		oldCr, ok := oldSet[newCr.Name]
+
+		if ok {
+			oldCrCopy := oldCr.DeepCopy()
+			newCrCopy := newCr.DeepCopy()
+			oldCrCopy.Rules = newCrCopy.Rules
+			oldCrCopy.Labels = newCrCopy.Labels
+			copySourceAnnotation(&oldCrCopy.ObjectMeta, newCrCopy.ObjectMeta)
+			updates = append(updates, oldCrCopy)
+		}
+	}
+
+	return updates
+}
+
+// getClusterRoles returns all deep-copied ClusterRoles with managed annotation
+func (roles *TKEAuthRoles) getClusterRoles() ([]*v14.ClusterRole, error) {
+	CRs, err := roles.ClusterRoleLister.List(labels.NewSelector())
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*v14.ClusterRole, 0)
+
+	for _, cr := range CRs {
+		if _, ok := cr.Annotations[AnnotationKeyManagedTKEAuthCRB]; ok {
+			ret = append(ret, cr.DeepCopy())
+		}
+	}
+
+	return ret, nil
+}
+
+func (roles *TKEAuthRoles) waitUntilCacheSync() {
+	retryCount := 0
+	for {
+		klog.V(log.VerboseLevel).Infof("Waiting TKEAuthRoles cache to be synced... retryCount: %d", retryCount)
+		if cache.WaitForCacheSync(roles.stopCh, roles.ClusterRoleSynced, roles.RoleSynced) {
+			klog.V(log.VerboseLevel).Infoln("TKEAuthRoles cache synced.")
+			break
+		} else {
+			retryCount += 1
+
+			if retryCount > syncRetryCountLimit {
+				panic("Cannot sync ClusterRole and Role.")
+			}
+		}
+	}
+}
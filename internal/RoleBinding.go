@@ -0,0 +1,310 @@
+package internal
+
+import (
+	"context"
+	"example.com/tke-auth-controller/log"
+	"github.com/thoas/go-funk"
+	v14 "k8s.io/api/rbac/v1"
+	v15 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/sets"
+	v1 "k8s.io/client-go/informers/rbac/v1"
+	v13 "k8s.io/client-go/kubernetes/typed/rbac/v1"
+	v12 "k8s.io/client-go/listers/rbac/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	"strings"
+	"time"
+)
+
+type TKEAuthRoleBindings struct {
+	Informer v1.RoleBindingInformer
+	Lister   v12.RoleBindingLister
+	Synced   cache.InformerSynced
+
+	rbGetter v13.RoleBindingsGetter
+	// applied is RBs written by controller, see Drift
+	applied *appliedBindings
+
+	stopCh <-chan struct{}
+}
+
+func NewTKEAuthRoleBinding(informer v1.RoleBindingInformer, lister v12.RoleBindingLister, rbGetter v13.RoleBindingsGetter, stopCh <-chan struct{}) *TKEAuthRoleBindings {
+	rb := &TKEAuthRoleBindings{
+		Informer: informer,
+		Lister:   lister,
+		Synced:   informer.Informer().HasSynced,
+		rbGetter: rbGetter,
+		applied:  newAppliedBindings(),
+		stopCh:   stopCh,
+	}
+
+	return rb
+}
+
+// RoleBindingPlan is changes of RBs to apply newRBs, see PlanRoleBindings
+type RoleBindingPlan struct {
+	Additions []*v14.RoleBinding
+	Updates   []*v14.RoleBinding
+	Deletions []*v14.RoleBinding
+	// Recreations bind another role, they are deleted and created again since roleRef is immutable
+	Recreations []*v14.RoleBinding
+	// Releases are RBs adopted with AdoptPolicyMerge and not claimed anymore, restored to subjects before adopted instead of being deleted
+	Releases []*v14.RoleBinding
+	// Managed is number of managed RBs before plan is applied
+	Managed int
+
+	// old is RBs to be changed by plan, key is "namespace/name"
+	old map[string]*v14.RoleBinding
+}
+
+// PlanRoleBindings returns changes to apply newRBs and delete managed RBs not in newRBs.
+// RBs created from skipSources are kept untouched, unless newRBs has RB of same namespace and name.
+// expired subjects are still revoked from kept RBs created only from expireSources.
+// unmanaged RBs in adoptions are taken over instead of being created.
+func (TKEAuthRB *TKEAuthRoleBindings) PlanRoleBindings(newRBs []*v14.RoleBinding, skipSources sets.String, expireSources sets.String, adoptions Adoptions) (*RoleBindingPlan, error) {
+	TKEAuthRB.waitUntilCacheSync()
+
+	RBs, err := TKEAuthRB.getRoleBindings()
+	if err != nil {
+		return nil, err
+	}
+	managed := len(RBs)
+
+	claimed := sets.NewString()
+	for _, new := range newRBs {
+		claimed.Insert(roleBindingKey(new))
+	}
+
+	adopted, err := TKEAuthRB.getAdoptedRoleBindings(claimed, adoptions)
+	if err != nil {
+		return nil, err
+	}
+	RBs = append(RBs, adopted...)
+
+	// keep subjects of failed sources in merged RB
+	for _, newRb := range newRBs {
+		for _, rb := range RBs {
+			if roleBindingKey(rb) == roleBindingKey(newRb) {
+				newRb.Subjects = retainSubjectsOfSources(&newRb.ObjectMeta, newRb.Subjects, rb.ObjectMeta, rb.Subjects, skipSources)
+			}
+		}
+	}
+
+	oldRBs := make([]*v14.RoleBinding, 0)
+	revocations := make([]*v14.RoleBinding, 0)
+	now := time.Now()
+	for _, rb := range RBs {
+		// object claimed by another source is not skipped, the other source takes it over
+		if isCreatedFromSources(rb.ObjectMeta, skipSources) && !claimed.Has(roleBindingKey(rb)) {
+			klog.V(log.VerboseLevel).Infof("skipping RB %s, source %s is failed to sync.\n", roleBindingKey(rb), rb.Annotations[AnnotationKeySource])
+
+			subjects, expiry := withoutExpiredSubjects(rb.ObjectMeta, rb.Subjects, now)
+			if isCreatedOnlyFromSources(rb.ObjectMeta, expireSources) && len(subjects) < len(rb.Subjects) {
+				klog.Infof("revoking expired subjects of skipped RB %s\n", roleBindingKey(rb))
+				revoked := rb.DeepCopy()
+				revoked.Subjects = subjects
+				setSubjectExpiry(&revoked.ObjectMeta, expiry)
+				revocations = append(revocations, revoked)
+			}
+			continue
+		}
+
+		oldRBs = append(oldRBs, rb)
+	}
+
+	updates, recreations := splitRoleBindingRoleRefChanges(getRoleBindingUpdates(newRBs, oldRBs), oldRBs)
+	updates = append(updates, revocations...)
+	deletions, releases := releaseAdoptedRoleBindings(differenceRoleBindings(oldRBs, newRBs))
+	plan := &RoleBindingPlan{
+		Additions:   differenceRoleBindings(newRBs, oldRBs),
+		Updates:     updates,
+		Deletions:   deletions,
+		Recreations: recreations,
+		Releases:    releases,
+		Managed:     managed,
+		old:         make(map[string]*v14.RoleBinding),
+	}
+	for _, rb := range RBs {
+		plan.old[roleBindingKey(rb)] = rb
+	}
+
+	return plan, nil
+}
+
+// ApplyRoleBindings applies changes of plan
+func (TKEAuthRB *TKEAuthRoleBindings) ApplyRoleBindings(plan *RoleBindingPlan) error {
+	deletions := append(plan.Deletions, plan.Recreations...)
+	additions := append(plan.Additions, plan.Recreations...)
+	updates := plan.Updates
+	klog.Infof("RB changed. add: %d, update: %d, delete: %d\n", len(additions), len(updates), len(deletions))
+
+	// print add
+	klog.Infof("added RBs: %s\n", strings.Join(funk.Map(additions, roleBindingKey).([]string), ", "))
+
+	// print update
+	klog.Infof("updated RBs: %s\n", strings.Join(funk.Map(updates, roleBindingKey).([]string), ", "))
+
+	// print delete
+	klog.Infof("deleted RBs: %s\n", strings.Join(funk.Map(deletions, roleBindingKey).([]string), ", "))
+
+	// print release
+	klog.Infof("released RBs: %s\n", strings.Join(funk.Map(plan.Releases, roleBindingKey).([]string), ", "))
+
+	// total
+	klog.Infof("total RBs: %d\n", len(additions)+len(updates)+len(deletions))
+
+	err := TKEAuthRB.deleteRBs(deletions)
+	if err != nil {
+		return err
+	}
+	err = TKEAuthRB.addRBs(additions)
+	if err != nil {
+		return err
+	}
+	err = TKEAuthRB.updateRBs(updates)
+	if err != nil {
+		return err
+	}
+	err = TKEAuthRB.updateRBs(plan.Releases)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// roleBindingKey returns "namespace/name" of RoleBinding, since name of RoleBinding is unique only in namespace
+func roleBindingKey(rb *v14.RoleBinding) string {
+	return rb.Namespace + "/" + rb.Name
+}
+
+// differenceRoleBindings returns A - B in set, key is Namespace/Name
+func differenceRoleBindings(a, b []*v14.RoleBinding) []*v14.RoleBinding {
+	aSet := make(map[string]*v14.RoleBinding)
+
+	for _, rb := range a {
+		aSet[roleBindingKey(rb)] = rb
+	}
+
+	for _, rb := range b {
+		delete(aSet, roleBindingKey(rb))
+	}
+
+	arr := make([]*v14.RoleBinding, 0)
+	for _, val := range aSet {
+		arr = append(arr, val)
+	}
+
+	return arr
+}
+
+func getRoleBindingUpdates(new, old []*v14.RoleBinding) []*v14.RoleBinding {
+	oldSet := map[string]*v14.RoleBinding{}
+
+	// create oldSet
+	for _, rb := range old {
+		oldSet[roleBindingKey(rb)] = rb
+	}
+
+	updates := make([]*v14.RoleBinding, 0)
+
+	for _, newRb := range new {
+		oldRb, ok := oldSet[roleBindingKey(newRb)]
+
+		if ok {
+			oldRbCopy := oldRb.DeepCopy()
+			newRbCopy := newRb.DeepCopy()
+			oldRbCopy.Subjects = withAdoptedSubjects(oldRbCopy.ObjectMeta, newRbCopy.Subjects)
+			oldRbCopy.RoleRef = newRbCopy.RoleRef
+			copySourceAnnotation(&oldRbCopy.ObjectMeta, newRbCopy.ObjectMeta)
+			updates = append(updates, oldRbCopy)
+		}
+	}
+
+	return updates
+}
+
+func (TKEAuthRB *TKEAuthRoleBindings) addRBs(RBs []*v14.RoleBinding) error {
+	for _, rb := range RBs {
+		rb.Annotations[AnnotationKeyManagedTKEAuthCRB] = AnnotationValueManagedTKEAuthCRB
+		TKEAuthRB.applied.set(roleBindingKey(rb), rb.Subjects, rb.RoleRef)
+		created, err := TKEAuthRB.rbGetter.RoleBindings(rb.Namespace).Create(context.TODO(), rb, v15.CreateOptions{})
+		if err != nil {
+			return err
+		}
+		TKEAuthRB.applied.written(roleBindingKey(rb), created.ObjectMeta)
+	}
+
+	return nil
+}
+
+func (TKEAuthRB *TKEAuthRoleBindings) updateRBs(RBs []*v14.RoleBinding) error {
+	for _, rb := range RBs {
+		TKEAuthRB.applied.set(roleBindingKey(rb), rb.Subjects, rb.RoleRef)
+		updated, err := TKEAuthRB.rbGetter.RoleBindings(rb.Namespace).Update(context.TODO(), rb, v15.UpdateOptions{})
+		if err != nil {
+			return err
+		}
+		TKEAuthRB.applied.written(roleBindingKey(rb), updated.ObjectMeta)
+	}
+
+	return nil
+}
+
+func (TKEAuthRB *TKEAuthRoleBindings) deleteRBs(RBs []*v14.RoleBinding) error {
+	for _, rb := range RBs {
+		checkRoleBindingIsManaged(rb)
+		TKEAuthRB.applied.remove(roleBindingKey(rb))
+		err := TKEAuthRB.rbGetter.RoleBindings(rb.Namespace).Delete(context.TODO(), rb.Name, v15.DeleteOptions{})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// check roleBinding has managed annotation, logs error if not.
+func checkRoleBindingIsManaged(rb *v14.RoleBinding) {
+	if _, ok := rb.Annotations[AnnotationKeyManagedTKEAuthCRB]; !ok {
+		klog.Errorf("tried to modify RoleBinding namespace: %s, name: %s but it's not managed by TKE-Auth controller.\n", rb.Namespace, rb.Name)
+	}
+}
+
+// getRoleBindings returns all deep-copied RoleBindings with managed annotation in every namespace
+func (TKEAuthRB *TKEAuthRoleBindings) getRoleBindings() ([]*v14.RoleBinding, error) {
+	TKEAuthRB.waitUntilCacheSync()
+
+	RBs, err := TKEAuthRB.Lister.List(labels.NewSelector())
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*v14.RoleBinding, 0)
+
+	for _, rb := range RBs {
+		if _, ok := rb.Annotations[AnnotationKeyManagedTKEAuthCRB]; ok {
+			ret = append(ret, rb.DeepCopy())
+		}
+	}
+
+	return ret, nil
+}
+
+func (TKEAuthRB *TKEAuthRoleBindings) waitUntilCacheSync() {
+	retryCount := 0
+	for {
+		klog.V(log.VerboseLevel).Infof("Waiting TKEAuthRoleBindings cache to be synced... retryCount: %d", retryCount)
+		if cache.WaitForCacheSync(TKEAuthRB.stopCh, TKEAuthRB.Synced) {
+			klog.V(log.VerboseLevel).Infoln("TKEAuthRoleBindings cache synced.")
+			break
+		} else {
+			retryCount += 1
+
+			if retryCount > syncRetryCountLimit {
+				panic("Cannot sync RoleBinding.")
+			}
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package internal
+
+import (
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	"time"
+)
+
+// Schedule is recurring window of access. window opens at every Cron and closes after Duration
+type Schedule struct {
+	// Cron is standard 5 fields cron expression of window start. eg: "0 9 * * 1-5"
+	Cron string `yaml:"cron"`
+	// Duration is length of window, go duration format. eg: "8h", "30m"
+	Duration string `yaml:"duration"`
+	// Timezone is IANA timezone of Cron. eg: "Asia/Seoul". default is UTC
+	Timezone string `yaml:"timezone"`
+}
+
+// parse returns cron schedule, duration and location of Schedule
+func (s *Schedule) parse() (cron.Schedule, time.Duration, *time.Location, error) {
+	spec, err := cron.ParseStandard(s.Cron)
+	if err != nil {
+		return nil, 0, nil, errors.Wrapf(err, "invalid cron %s", s.Cron)
+	}
+
+	duration, err := time.ParseDuration(s.Duration)
+	if err != nil {
+		return nil, 0, nil, errors.Wrapf(err, "invalid duration %s", s.Duration)
+	}
+	if duration <= 0 {
+		return nil, 0, nil, errors.Errorf("duration %s should be positive", s.Duration)
+	}
+
+	location, err := time.LoadLocation(s.Timezone) // "" is UTC
+	if err != nil {
+		return nil, 0, nil, errors.Wrapf(err, "invalid timezone %s", s.Timezone)
+	}
+
+	return spec, duration, location, nil
+}
+
+// Validate returns error if schedule cannot be parsed. nil schedule is valid, which means always open
+func (s *Schedule) Validate() error {
+	if s == nil {
+		return nil
+	}
+
+	_, _, _, err := s.parse()
+	return errors.Wrap(err, "schedule")
+}
+
+// IsOpen returns true if window is open at now. nil schedule is always open, invalid schedule is never open
+func (s *Schedule) IsOpen(now time.Time) bool {
+	if s == nil {
+		return true
+	}
+
+	spec, duration, location, err := s.parse()
+	if err != nil {
+		return false
+	}
+
+	// window [start, start+duration) contains now if first start after now-duration is not after now
+	start := spec.Next(now.Add(-duration).In(location))
+	return !start.After(now)
+}
+
+// NextTransition returns time when window opens or closes after now, zero if schedule is nil or invalid
+func (s *Schedule) NextTransition(now time.Time) time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+
+	spec, duration, location, err := s.parse()
+	if err != nil {
+		return time.Time{}
+	}
+
+	start := spec.Next(now.Add(-duration).In(location))
+	if !start.After(now) { // open, closes at end of current window
+		return start.Add(duration)
+	}
+
+	return start
+}
@@ -0,0 +1,119 @@
+package internal
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // timezones of schedules do not depend on tzdata of host
+)
+
+func mustParseTime(t *testing.T, value string) time.Time {
+	t.Helper()
+
+	ret, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatalf("cannot parse time %s: %s", value, err)
+	}
+
+	return ret
+}
+
+var (
+	// 09:00 ~ 17:00 on weekdays
+	weekdaySchedule = &Schedule{Cron: "0 9 * * 1-5", Duration: "8h"}
+	// 22:00 ~ 02:00 of next day
+	nightSchedule = &Schedule{Cron: "0 22 * * *", Duration: "4h"}
+	// 09:00 ~ 10:00 in Asia/Seoul, which has no DST
+	seoulSchedule = &Schedule{Cron: "0 9 * * *", Duration: "1h", Timezone: "Asia/Seoul"}
+	// 09:00 ~ 10:00 in America/New_York, DST starts at 2024-03-10 and ends at 2024-11-03
+	newYorkSchedule = &Schedule{Cron: "0 9 * * *", Duration: "1h", Timezone: "America/New_York"}
+)
+
+func TestScheduleIsOpen(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule *Schedule
+		now      string
+		want     bool
+	}{
+		{"nil schedule is always open", nil, "2024-01-08T00:00:00Z", true},
+		{"invalid cron is never open", &Schedule{Cron: "invalid", Duration: "1h"}, "2024-01-08T09:30:00Z", false},
+		{"invalid duration is never open", &Schedule{Cron: "0 9 * * *", Duration: "0s"}, "2024-01-08T09:00:00Z", false},
+		{"invalid timezone is never open", &Schedule{Cron: "0 9 * * *", Duration: "1h", Timezone: "Invalid/Zone"}, "2024-01-08T09:00:00Z", false},
+
+		{"before window", weekdaySchedule, "2024-01-08T08:59:59Z", false},
+		{"window opens at start", weekdaySchedule, "2024-01-08T09:00:00Z", true},
+		{"in window", weekdaySchedule, "2024-01-08T12:00:00Z", true},
+		{"right before window closes", weekdaySchedule, "2024-01-08T16:59:59Z", true},
+		{"window closes at end", weekdaySchedule, "2024-01-08T17:00:00Z", false},
+		{"weekend", weekdaySchedule, "2024-01-13T10:00:00Z", false},
+
+		{"window spanning midnight, before midnight", nightSchedule, "2024-01-08T23:00:00Z", true},
+		{"window spanning midnight, after midnight", nightSchedule, "2024-01-09T01:59:59Z", true},
+		{"window spanning midnight, closed", nightSchedule, "2024-01-09T02:00:00Z", false},
+		{"window spanning midnight, before start", nightSchedule, "2024-01-08T21:59:59Z", false},
+
+		{"timezone, open", seoulSchedule, "2024-01-08T00:00:00Z", true},
+		{"timezone, closed at 09:00 UTC", seoulSchedule, "2024-01-08T09:00:00Z", false},
+
+		{"before DST starts, 09:00 EST", newYorkSchedule, "2024-03-09T14:30:00Z", true},
+		{"before DST starts, 08:30 EST", newYorkSchedule, "2024-03-09T13:30:00Z", false},
+		{"after DST starts, 09:30 EDT", newYorkSchedule, "2024-03-10T13:30:00Z", true},
+		{"after DST starts, 10:30 EDT", newYorkSchedule, "2024-03-10T14:30:00Z", false},
+		{"after DST ends, 08:30 EST", newYorkSchedule, "2024-11-03T13:30:00Z", false},
+		{"after DST ends, 09:30 EST", newYorkSchedule, "2024-11-03T14:30:00Z", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.IsOpen(mustParseTime(t, tt.now)); got != tt.want {
+				t.Errorf("IsOpen(%s) = %t, want %t", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleNextTransition(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule *Schedule
+		now      string
+		want     string // empty if zero
+	}{
+		{"nil schedule", nil, "2024-01-08T00:00:00Z", ""},
+		{"invalid schedule", &Schedule{Cron: "invalid", Duration: "1h"}, "2024-01-08T00:00:00Z", ""},
+
+		{"closed, opens at start", weekdaySchedule, "2024-01-08T08:00:00Z", "2024-01-08T09:00:00Z"},
+		{"open at start, closes at end", weekdaySchedule, "2024-01-08T09:00:00Z", "2024-01-08T17:00:00Z"},
+		{"open, closes at end", weekdaySchedule, "2024-01-08T10:00:00Z", "2024-01-08T17:00:00Z"},
+		{"closed at end, opens next day", weekdaySchedule, "2024-01-08T17:00:00Z", "2024-01-09T09:00:00Z"},
+		{"friday after window, opens on monday", weekdaySchedule, "2024-01-12T18:00:00Z", "2024-01-15T09:00:00Z"},
+
+		{"window spanning midnight, closes next day", nightSchedule, "2024-01-08T23:00:00Z", "2024-01-09T02:00:00Z"},
+		{"window spanning midnight, after midnight", nightSchedule, "2024-01-09T01:00:00Z", "2024-01-09T02:00:00Z"},
+		{"window spanning midnight, closed", nightSchedule, "2024-01-09T02:00:00Z", "2024-01-09T22:00:00Z"},
+
+		{"timezone, opens at 09:00 KST", seoulSchedule, "2024-01-07T23:00:00Z", "2024-01-08T00:00:00Z"},
+		{"timezone, closes at 10:00 KST", seoulSchedule, "2024-01-08T00:30:00Z", "2024-01-08T01:00:00Z"},
+
+		{"DST starts, opens one hour earlier in UTC", newYorkSchedule, "2024-03-09T15:00:00Z", "2024-03-10T13:00:00Z"},
+		{"DST starts, closes at 10:00 EDT", newYorkSchedule, "2024-03-10T13:30:00Z", "2024-03-10T14:00:00Z"},
+		{"DST ends, opens one hour later in UTC", newYorkSchedule, "2024-11-02T14:00:00Z", "2024-11-03T14:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.schedule.NextTransition(mustParseTime(t, tt.now))
+
+			if tt.want == "" {
+				if !got.IsZero() {
+					t.Errorf("NextTransition(%s) = %s, want zero", tt.now, got)
+				}
+				return
+			}
+
+			if want := mustParseTime(t, tt.want); !got.Equal(want) {
+				t.Errorf("NextTransition(%s) = %s, want %s", tt.now, got.UTC().Format(time.RFC3339), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"example.com/tke-auth-controller/log"
+	"github.com/pkg/errors"
+	v12 "k8s.io/api/core/v1"
+	v13 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	v1 "k8s.io/client-go/informers/core/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// LabelKeyTKEAuthSecret is label required on secret with "tke-auth/binding" annotation.
+	// only secrets with the label are watched, so that other secrets are not cached by controller
+	LabelKeyTKEAuthSecret = "tke-auth/binding"
+)
+
+// TKEAuthSecrets is secrets with "tke-auth/binding" annotation, same as TKEAuthConfigMaps for sensitive users.
+// informer should be filtered by LabelKeyTKEAuthSecret, see TweakSecretListOptions
+type TKEAuthSecrets struct {
+	Informer v1.SecretInformer
+	Lister   listersv1.SecretLister
+	Synced   cache.InformerSynced
+
+	secretGetter corev1.SecretsGetter
+
+	stopCh <-chan struct{}
+}
+
+func NewTKEAuthSecrets(informer v1.SecretInformer, lister listersv1.SecretLister, secretGetter corev1.SecretsGetter) *TKEAuthSecrets {
+	authSecret := TKEAuthSecrets{
+		Informer:     informer,
+		Lister:       lister,
+		Synced:       informer.Informer().HasSynced,
+		secretGetter: secretGetter,
+	}
+
+	return &authSecret
+}
+
+// TweakSecretListOptions filters secrets watched by informer with LabelKeyTKEAuthSecret
+func TweakSecretListOptions(options *v13.ListOptions) {
+	options.LabelSelector = LabelKeyTKEAuthSecret
+}
+
+// SecretReference returns reference of secret, used as source of TKEAuth
+func SecretReference(secret *v12.Secret) v12.ObjectReference {
+	return v12.ObjectReference{
+		Kind:            "Secret",
+		APIVersion:      "v1",
+		Namespace:       secret.Namespace,
+		Name:            secret.Name,
+		UID:             secret.UID,
+		ResourceVersion: secret.ResourceVersion,
+	}
+}
+
+// secretData returns data of secret as string, keys are same as configMap
+func secretData(secret *v12.Secret) map[string]string {
+	data := make(map[string]string)
+	for key, value := range secret.Data {
+		data[key] = string(value)
+	}
+
+	return data
+}
+
+// SecretToTKEAuths returns TKEAuths of secret, parsed same as configMap. see ToTKEAuths
+func SecretToTKEAuths(secret *v12.Secret) ([]*TKEAuth, []error) {
+	return dataToTKEAuths(secretData(secret), SecretReference(secret), secret.CreationTimestamp)
+}
+
+// GetTKEAuthSecrets returns all deep-copied secret with "tke-auth/binding" annotation attached,
+// and secret with finalizer of controller whose annotation is removed. see IsReleased
+func (s *TKEAuthSecrets) GetTKEAuthSecrets() ([]*v12.Secret, error) {
+	s.waitUntilCacheSync()
+
+	secrets, err := s.Lister.List(labels.NewSelector())
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*v12.Secret, 0)
+
+	for _, secret := range secrets {
+		if _, ok := secret.Annotations[AnnotationKeyTKEAuthConfigMap]; ok || HasFinalizer(secret.ObjectMeta) {
+			ret = append(ret, secret.DeepCopy())
+		}
+	}
+
+	return ret, nil
+}
+
+// UpdateStatus patches status annotations of sync to secret, resourceVersion of secret is updated to patched one
+func (s *TKEAuthSecrets) UpdateStatus(secret *v12.Secret, status *SyncStatus) error {
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": status.toAnnotations(),
+		},
+	}
+
+	buf, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+
+	patched, err := s.secretGetter.Secrets(secret.Namespace).Patch(context.TODO(), secret.Name, types.MergePatchType, buf, v13.PatchOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "cannot update status of secret %s/%s", secret.Namespace, secret.Name)
+	}
+	secret.ResourceVersion = patched.ResourceVersion
+
+	return nil
+}
+
+// wait until cache Synced
+func (s *TKEAuthSecrets) waitUntilCacheSync() {
+	retryCount := 0
+	for {
+		klog.V(log.VerboseLevel).Infof("Waiting TKEAuthSecret cache to be synced... retryCount: %d", retryCount)
+		if cache.WaitForCacheSync(s.stopCh, s.Synced) {
+			klog.V(log.VerboseLevel).Infoln("TKEAuthSecret cache synced.")
+			break
+		} else {
+			retryCount += 1
+
+			if retryCount > syncRetryCountLimit {
+				panic("Cannot sync Secret.")
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package internal
+
+import (
+	v12 "k8s.io/api/core/v1"
+	v13 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	annotationPrefixStatus = "status.tke-auth/"
+
+	AnnotationKeyStatusLastSyncTime            = annotationPrefixStatus + "last-sync-time"
+	AnnotationKeyStatusObservedResourceVersion = annotationPrefixStatus + "observed-resource-version"
+	AnnotationKeyStatusResolvedUsers           = annotationPrefixStatus + "resolved-users"
+	AnnotationKeyStatusUnresolvedUsers         = annotationPrefixStatus + "unresolved-users"
+	AnnotationKeyStatusGeneratedBindings       = annotationPrefixStatus + "generated-bindings"
+	AnnotationKeyStatusLastError               = annotationPrefixStatus + "last-error"
+	AnnotationKeyStatusExpired                 = annotationPrefixStatus + "expired"
+)
+
+// SyncStatus is result of last sync of a source object
+type SyncStatus struct {
+	LastSyncTime            time.Time
+	ObservedResourceVersion string
+	// Failed is true if source failed to sync. user counts and bindings of last successful sync are kept.
+	Failed          bool
+	ResolvedUsers   int
+	UnresolvedUsers int
+	Bindings        []string
+	LastError       string
+	// Expired is bindings and users removed by expiresAt, "<bindingName>" or "<bindingName>/<kind>/<value>"
+	Expired []string
+}
+
+// NewSyncStatus returns SyncStatus of source, from TKEAuths converted from the source, expired entries and error of sync
+func NewSyncStatus(source v12.ObjectReference, tkeAuths []*TKEAuth, expired []string, syncErr error) *SyncStatus {
+	status := &SyncStatus{
+		LastSyncTime:            time.Now(),
+		ObservedResourceVersion: source.ResourceVersion,
+		Failed:                  syncErr != nil,
+		Bindings:                make([]string, 0),
+		Expired:                 append([]string{}, expired...),
+	}
+	sort.Strings(status.Expired)
+
+	if syncErr != nil {
+		status.LastError = syncErr.Error()
+		return status
+	}
+
+	// same user can be in multiple bindings of a configMap, count once
+	users := make(map[string]bool)
+	for _, tkeAuth := range tkeAuths {
+		status.Bindings = append(status.Bindings, tkeAuth.BindingName)
+
+		for _, user := range tkeAuth.Users {
+			users[user.Kind+"/"+user.Namespace+"/"+user.Value] = user.Resolved
+		}
+	}
+
+	for _, resolved := range users {
+		if resolved {
+			status.ResolvedUsers += 1
+		} else {
+			status.UnresolvedUsers += 1
+		}
+	}
+	sort.Strings(status.Bindings)
+
+	return status
+}
+
+// toAnnotations returns status annotations of configMap and secret. counts and bindings are omitted if sync is failed
+func (status *SyncStatus) toAnnotations() map[string]string {
+	annotations := map[string]string{
+		AnnotationKeyStatusLastSyncTime:            status.LastSyncTime.UTC().Format(time.RFC3339),
+		AnnotationKeyStatusObservedResourceVersion: status.ObservedResourceVersion,
+		AnnotationKeyStatusLastError:               status.LastError,
+	}
+
+	if !status.Failed {
+		annotations[AnnotationKeyStatusResolvedUsers] = strconv.Itoa(status.ResolvedUsers)
+		annotations[AnnotationKeyStatusUnresolvedUsers] = strconv.Itoa(status.UnresolvedUsers)
+		annotations[AnnotationKeyStatusGeneratedBindings] = strings.Join(status.Bindings, ", ")
+		annotations[AnnotationKeyStatusExpired] = strings.Join(status.Expired, ", ")
+	}
+
+	return annotations
+}
+
+// IsOnlyStatusAnnotationChanged returns true if new configMap differs from old only by status annotations,
+// which means the change is made by controller itself.
+func IsOnlyStatusAnnotationChanged(old, new *v12.ConfigMap) bool {
+	return isOnlyStatusAnnotationChanged(old.ObjectMeta, new.ObjectMeta, old.Data, new.Data)
+}
+
+// IsOnlySecretStatusAnnotationChanged returns true if new secret differs from old only by status annotations
+func IsOnlySecretStatusAnnotationChanged(old, new *v12.Secret) bool {
+	return isOnlyStatusAnnotationChanged(old.ObjectMeta, new.ObjectMeta, secretData(old), secretData(new))
+}
+
+func isOnlyStatusAnnotationChanged(oldMeta, newMeta v13.ObjectMeta, oldData, newData map[string]string) bool {
+	if oldMeta.ResourceVersion == newMeta.ResourceVersion { // periodic resync
+		return false
+	}
+
+	if (oldMeta.DeletionTimestamp == nil) != (newMeta.DeletionTimestamp == nil) { // deleted, waiting for finalizer
+		return false
+	}
+
+	if len(oldData) != len(newData) {
+		return false
+	}
+
+	for key, value := range oldData {
+		if newValue, ok := newData[key]; !ok || newValue != value {
+			return false
+		}
+	}
+
+	return withoutStatusAnnotations(oldMeta.Annotations) == withoutStatusAnnotations(newMeta.Annotations)
+}
+
+// withoutStatusAnnotations returns string of annotations except status annotations, for comparison
+func withoutStatusAnnotations(annotations map[string]string) string {
+	keys := make([]string, 0)
+	for key := range annotations {
+		if !strings.HasPrefix(key, annotationPrefixStatus) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	builder := strings.Builder{}
+	for _, key := range keys {
+		builder.WriteString(key + "=" + annotations[key] + "\n")
+	}
+
+	return builder.String()
+}
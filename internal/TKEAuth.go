@@ -1,24 +1,262 @@
 package internal
 
 import (
+	"github.com/pkg/errors"
+	v12 "k8s.io/api/core/v1"
 	v1 "k8s.io/api/rbac/v1"
 	v15 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"strings"
+	"time"
 )
 
 type User struct {
+	// Kind is kind of subject, one of User, Group, ServiceAccount. default is User
+	Kind      string `yaml:"kind"`
 	ValueType string `yaml:"type"`
 	Value     string `yaml:"value"`
+	// Namespace is namespace of ServiceAccount, only used when Kind is ServiceAccount
+	Namespace string `yaml:"namespace"`
+	// Group is name of user group to expand, other fields are ignored if not empty. see UserGroup
+	Group string `yaml:"group"`
+	// NotBefore, ExpiresAt are RFC3339 time, user is granted only in [NotBefore, ExpiresAt) if provided
+	NotBefore string `yaml:"notBefore"`
+	ExpiresAt string `yaml:"expiresAt"`
+	// Schedule grants user only while recurring window is open if provided
+	Schedule *Schedule `yaml:"schedule"`
+
+	// Resolved is true if Value is converted to CommonName by CommonNameResolver, or used as-is
+	Resolved bool `yaml:"-"`
+	// GrantedUntil is time when user stops being granted, set by ExcludeInactiveUsers. zero if granted without limit
+	GrantedUntil time.Time `yaml:"-"`
+}
+
+// Rule is PolicyRule of ClusterRole managed by TKEAuth
+type Rule struct {
+	Verbs           []string `yaml:"verbs"`
+	APIGroups       []string `yaml:"apiGroups"`
+	Resources       []string `yaml:"resources"`
+	ResourceNames   []string `yaml:"resourceNames"`
+	NonResourceURLs []string `yaml:"nonResourceURLs"`
+}
+
+// IsGroupRef returns true if user is reference of user group, which is replaced by users of the group
+func (u *User) IsGroupRef() bool {
+	return u.Group != ""
+}
+
+// NeedsResolve returns true if user.Value should be converted to CommonName by CommonNameResolver.
+// Group and ServiceAccount are used as-is.
+func (u *User) NeedsResolve() bool {
+	return u.Kind == v1.UserKind
 }
 
 type TKEAuth struct {
 	DefaultUserValueType string `yaml:"defaultUserValueType"`
 	BindingName          string `yaml:"bindingName"`
 	RoleName             string `yaml:"roleName"`
-	Users                []User `yaml:"users"`
+	// RoleKind is kind of role to bind, one of ClusterRole, Role. default is ClusterRole
+	RoleKind string `yaml:"roleKind"`
+	// Namespaces creates RoleBinding in each namespace instead of ClusterRoleBinding if not empty
+	Namespaces []string `yaml:"namespaces"`
+	Users      []User   `yaml:"users"`
+	// Rules creates ClusterRole named RoleName managed by controller if not empty
+	Rules []Rule `yaml:"rules"`
+	// Merge allows other sources to share the binding, subjects of every source are merged into one binding.
+	// every source of the binding should enable Merge and have same role.
+	Merge bool `yaml:"merge"`
+	// Adopt decides how existing binding of same name without managed annotation is handled, one of AdoptPolicies. default is fail
+	Adopt string `yaml:"adopt"`
+	// AggregationLabels is labels of managed ClusterRole, eg: rbac.authorization.k8s.io/aggregate-to-view: "true"
+	AggregationLabels map[string]string `yaml:"aggregationLabels"`
+	// NotBefore, ExpiresAt are RFC3339 time, binding is created only in [NotBefore, ExpiresAt) if provided
+	NotBefore string `yaml:"notBefore"`
+	ExpiresAt string `yaml:"expiresAt"`
+	// Schedule creates binding only while recurring window is open if provided
+	Schedule *Schedule `yaml:"schedule"`
+
+	// UserGroups is names of user groups referenced by users, set by ExpandUserGroups
+	UserGroups []string `yaml:"-"`
+
+	// Source is reference of the object which TKEAuth is converted from
+	Source v12.ObjectReference `yaml:"-"`
+	// SourceCreationTimestamp is creationTimestamp of source object, used to resolve conflicts between sources
+	SourceCreationTimestamp v15.Time `yaml:"-"`
+}
+
+// SourceKey returns "Kind/namespace/name" of source object, used as key of source in sync
+func SourceKey(ref v12.ObjectReference) string {
+	return ref.Kind + "/" + ref.Namespace + "/" + ref.Name
+}
+
+// IsNamespaced returns true if TKEAuth should be converted to RoleBindings instead of ClusterRoleBinding
+func (t *TKEAuth) IsNamespaced() bool {
+	return len(t.Namespaces) > 0
 }
 
+// HasRules returns true if ClusterRole of TKEAuth should be created by controller
+func (t *TKEAuth) HasRules() bool {
+	return len(t.Rules) > 0
+}
+
+// withBindingEntry returns copy of TKEAuth with name, role, namespaces of entry, and users filtered by entry.Users
+func (t *TKEAuth) withBindingEntry(entry BindingEntry) (*TKEAuth, error) {
+	tkeAuth := &TKEAuth{
+		DefaultUserValueType: t.DefaultUserValueType,
+		BindingName:          entry.BindingName,
+		RoleName:             entry.RoleName,
+		RoleKind:             entry.RoleKind,
+		Namespaces:           entry.Namespaces,
+		Users:                make([]User, 0),
+		Rules:                entry.Rules,
+		Merge:                entry.Merge,
+		Adopt:                entry.Adopt,
+		AggregationLabels:    entry.AggregationLabels,
+		NotBefore:            entry.NotBefore,
+		ExpiresAt:            entry.ExpiresAt,
+		Schedule:             entry.Schedule,
+		Source:               t.Source,
+
+		SourceCreationTimestamp: t.SourceCreationTimestamp,
+	}
+
+	if tkeAuth.RoleKind == "" {
+		tkeAuth.RoleKind = "ClusterRole"
+	}
+
+	if tkeAuth.Adopt == "" {
+		tkeAuth.Adopt = t.Adopt
+	}
+
+	if len(entry.Users) == 0 {
+		tkeAuth.Users = append(tkeAuth.Users, t.Users...)
+		return tkeAuth, nil
+	}
+
+	// user group reference is selected by name of group
+	usersByValue := make(map[string]User)
+	for _, user := range t.Users {
+		if user.IsGroupRef() {
+			usersByValue[user.Group] = user
+		} else {
+			usersByValue[user.Value] = user
+		}
+	}
+
+	for _, value := range entry.Users {
+		user, ok := usersByValue[value]
+		if !ok {
+			return nil, errors.Errorf("user %s is not in users of configMap.", value)
+		}
+
+		tkeAuth.Users = append(tkeAuth.Users, user)
+	}
+
+	return tkeAuth, nil
+}
+
+// setDefaults fills roleKind, user.Kind and user.ValueType if not provided
+func (t *TKEAuth) setDefaults() {
+	if t.RoleKind == "" {
+		t.RoleKind = "ClusterRole"
+	}
+
+	for i := 0; i < len(t.Users); i++ {
+		user := &t.Users[i]
+		if user.IsGroupRef() {
+			continue
+		}
+
+		if user.Kind == "" {
+			user.Kind = v1.UserKind
+		}
+
+		if user.ValueType == "" && user.NeedsResolve() {
+			user.ValueType = t.DefaultUserValueType
+		}
+	}
+}
+
+// Validate checks kind of role and users, and namespace of ServiceAccount exists.
+func (t *TKEAuth) Validate(namespaceLister listersv1.NamespaceLister) error {
+	switch t.RoleKind {
+	case "ClusterRole":
+	case "Role":
+		if !t.IsNamespaced() {
+			return errors.Errorf("binding: %s, roleKind Role requires namespaces.", t.BindingName)
+		}
+	default:
+		return errors.Errorf("binding: %s, unknown roleKind: %s", t.BindingName, t.RoleKind)
+	}
+
+	if t.HasRules() && t.RoleKind != "ClusterRole" {
+		return errors.Errorf("binding: %s, rules can be used only with roleKind ClusterRole.", t.BindingName)
+	}
+
+	if t.Adopt != "" && !sets.NewString(AdoptPolicies...).Has(t.Adopt) {
+		return errors.Errorf("binding: %s, unknown adopt: %s, should be one of %s", t.BindingName, t.Adopt, strings.Join(AdoptPolicies, ", "))
+	}
+
+	if err := validateTimeRange(t.NotBefore, t.ExpiresAt); err != nil {
+		return errors.Wrapf(err, "binding: %s", t.BindingName)
+	}
+
+	if err := t.Schedule.Validate(); err != nil {
+		return errors.Wrapf(err, "binding: %s", t.BindingName)
+	}
+
+	for _, user := range t.Users {
+		if user.IsGroupRef() {
+			return errors.Errorf("binding: %s, user group %s is not expanded.", t.BindingName, user.Group)
+		}
+
+		if user.Value == "" {
+			return errors.Errorf("binding: %s, value of user is empty.", t.BindingName)
+		}
+
+		if err := validateTimeRange(user.NotBefore, user.ExpiresAt); err != nil {
+			return errors.Wrapf(err, "binding: %s, user: %s", t.BindingName, user.Value)
+		}
+
+		if err := user.Schedule.Validate(); err != nil {
+			return errors.Wrapf(err, "binding: %s, user: %s", t.BindingName, user.Value)
+		}
+
+		switch user.Kind {
+		case v1.UserKind, v1.GroupKind:
+			continue
+		case v1.ServiceAccountKind:
+			if user.Namespace == "" {
+				return errors.Errorf("binding: %s, namespace of ServiceAccount %s is empty.", t.BindingName, user.Value)
+			}
+
+			_, err := namespaceLister.Get(user.Namespace)
+			if err != nil {
+				return errors.Wrapf(err, "binding: %s, namespace of ServiceAccount %s does not exist", t.BindingName, user.Value)
+			}
+		default:
+			return errors.Errorf("binding: %s, unknown kind of user: %s, value: %s", t.BindingName, user.Kind, user.Value)
+		}
+	}
+
+	return nil
+}
+
+// CheckValueTypes returns error if value type of user to resolve is not in valueTypes, which cannot be converted to CommonName
+func (t *TKEAuth) CheckValueTypes(valueTypes sets.String) error {
+	for _, user := range t.Users {
+		if user.NeedsResolve() && !valueTypes.Has(user.ValueType) {
+			return errors.Errorf("binding: %s, unknown type of user: %s, value: %s. type should be one of %s", t.BindingName, user.ValueType, user.Value, valueTypes.List())
+		}
+	}
+
+	return nil
+}
+
+// ToClusterRoleBinding returns ClusterRoleBinding of every user, inactive users should be excluded by ExcludeInactiveUsers before
 func (t *TKEAuth) ToClusterRoleBinding() *v1.ClusterRoleBinding {
-	roleRef := toClusterRoleRef(t.RoleName)
+	roleRef := toRoleRef(t.RoleKind, t.RoleName)
 	subjects := make([]v1.Subject, 0)
 
 	for _, user := range t.Users {
@@ -35,19 +273,108 @@ func (t *TKEAuth) ToClusterRoleBinding() *v1.ClusterRoleBinding {
 			DeletionTimestamp:          nil,
 			DeletionGracePeriodSeconds: nil,
 			Labels:                     map[string]string{},
-			Annotations:                map[string]string{},
+			Annotations: map[string]string{
+				AnnotationKeySource:    SourceKey(t.Source),
+				AnnotationKeySourceUID: string(t.Source.UID),
+			},
 		},
 		Subjects: subjects,
 		RoleRef:  roleRef,
 	}
 
+	if t.Merge {
+		setSubjectSources(&crb.ObjectMeta, newSubjectSources(subjects, SourceKey(t.Source)))
+	}
+	setSubjectExpiry(&crb.ObjectMeta, t.subjectExpiry())
+
 	return crb
 }
 
-func toClusterRoleRef(roleName string) v1.RoleRef {
+// ToRoleBindings returns RoleBinding with same name for each namespace of TKEAuth.Namespaces, inactive users should be excluded like ToClusterRoleBinding
+func (t *TKEAuth) ToRoleBindings() []*v1.RoleBinding {
+	roleRef := toRoleRef(t.RoleKind, t.RoleName)
+	subjects := make([]v1.Subject, 0)
+
+	for _, user := range t.Users {
+		subjects = append(subjects, userToSubject(user))
+	}
+
+	rbs := make([]*v1.RoleBinding, 0)
+	for _, namespace := range t.Namespaces {
+		rb := &v1.RoleBinding{
+			TypeMeta: v15.TypeMeta{
+				Kind:       "RoleBinding",
+				APIVersion: "rbac.authorization.k8s.io/v1",
+			},
+			ObjectMeta: v15.ObjectMeta{
+				Name:      t.BindingName,
+				Namespace: namespace,
+				Labels:    map[string]string{},
+				Annotations: map[string]string{
+					AnnotationKeySource:    SourceKey(t.Source),
+					AnnotationKeySourceUID: string(t.Source.UID),
+				},
+			},
+			Subjects: append([]v1.Subject{}, subjects...),
+			RoleRef:  roleRef,
+		}
+
+		if t.Merge {
+			setSubjectSources(&rb.ObjectMeta, newSubjectSources(subjects, SourceKey(t.Source)))
+		}
+		setSubjectExpiry(&rb.ObjectMeta, t.subjectExpiry())
+
+		rbs = append(rbs, rb)
+	}
+
+	return rbs
+}
+
+// ToClusterRole returns ClusterRole named RoleName with Rules and AggregationLabels
+func (t *TKEAuth) ToClusterRole() *v1.ClusterRole {
+	rules := make([]v1.PolicyRule, 0)
+	for _, rule := range t.Rules {
+		rules = append(rules, v1.PolicyRule{
+			Verbs:           rule.Verbs,
+			APIGroups:       rule.APIGroups,
+			Resources:       rule.Resources,
+			ResourceNames:   rule.ResourceNames,
+			NonResourceURLs: rule.NonResourceURLs,
+		})
+	}
+
+	labels := map[string]string{}
+	for key, value := range t.AggregationLabels {
+		labels[key] = value
+	}
+
+	cr := &v1.ClusterRole{
+		TypeMeta: v15.TypeMeta{
+			Kind:       "ClusterRole",
+			APIVersion: "rbac.authorization.k8s.io/v1",
+		},
+		ObjectMeta: v15.ObjectMeta{
+			Name:   t.RoleName,
+			Labels: labels,
+			Annotations: map[string]string{
+				AnnotationKeySource:    SourceKey(t.Source),
+				AnnotationKeySourceUID: string(t.Source.UID),
+			},
+		},
+		Rules: rules,
+	}
+
+	return cr
+}
+
+func toRoleRef(roleKind string, roleName string) v1.RoleRef {
+	if roleKind == "" {
+		roleKind = "ClusterRole"
+	}
+
 	ref := v1.RoleRef{
 		APIGroup: "rbac.authorization.k8s.io",
-		Kind:     "ClusterRole",
+		Kind:     roleKind,
 		Name:     roleName,
 	}
 
@@ -55,8 +382,22 @@ func toClusterRoleRef(roleName string) v1.RoleRef {
 }
 
 func userToSubject(user User) v1.Subject {
+	if user.Kind == v1.ServiceAccountKind {
+		return v1.Subject{
+			Kind:      v1.ServiceAccountKind,
+			APIGroup:  "",
+			Name:      user.Value,
+			Namespace: user.Namespace,
+		}
+	}
+
+	kind := user.Kind
+	if kind == "" {
+		kind = v1.UserKind
+	}
+
 	subject := v1.Subject{
-		Kind:     "User",
+		Kind:     kind,
 		APIGroup: "rbac.authorization.k8s.io",
 		Name:     user.Value,
 	}
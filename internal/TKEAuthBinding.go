@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"context"
+	"example.com/tke-auth-controller/internal/apis/tkeauth/v1alpha1"
+	typedv1alpha1 "example.com/tke-auth-controller/internal/generated/clientset/versioned/typed/tkeauth/v1alpha1"
+	informersv1alpha1 "example.com/tke-auth-controller/internal/generated/informers/externalversions/tkeauth/v1alpha1"
+	listersv1alpha1 "example.com/tke-auth-controller/internal/generated/listers/tkeauth/v1alpha1"
+	"example.com/tke-auth-controller/log"
+	"github.com/pkg/errors"
+	v1 "k8s.io/api/core/v1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+type TKEAuthBindings struct {
+	Informer informersv1alpha1.TKEAuthBindingInformer
+	Lister   listersv1alpha1.TKEAuthBindingLister
+	Synced   cache.InformerSynced
+
+	bindingGetter typedv1alpha1.TKEAuthBindingsGetter
+
+	stopCh <-chan struct{}
+}
+
+func NewTKEAuthBindings(informer informersv1alpha1.TKEAuthBindingInformer, lister listersv1alpha1.TKEAuthBindingLister, bindingGetter typedv1alpha1.TKEAuthBindingsGetter) *TKEAuthBindings {
+	bindings := TKEAuthBindings{
+		Informer:      informer,
+		Lister:        lister,
+		Synced:        informer.Informer().HasSynced,
+		bindingGetter: bindingGetter,
+	}
+
+	return &bindings
+}
+
+// TKEAuthBindingReference returns reference of TKEAuthBinding, used as source of TKEAuth
+func TKEAuthBindingReference(binding *v1alpha1.TKEAuthBinding) v1.ObjectReference {
+	return v1.ObjectReference{
+		Kind:            "TKEAuthBinding",
+		APIVersion:      v1alpha1.SchemeGroupVersion.String(),
+		Namespace:       binding.Namespace,
+		Name:            binding.Name,
+		UID:             binding.UID,
+		ResourceVersion: binding.ResourceVersion,
+	}
+}
+
+// BindingToTKEAuth converts TKEAuthBinding to TKEAuth, works same as ToTKEAuth of ConfigMap
+func BindingToTKEAuth(binding *v1alpha1.TKEAuthBinding) (*TKEAuth, error) {
+	spec := binding.Spec
+
+	tkeAuth := &TKEAuth{
+		DefaultUserValueType: spec.DefaultUserValueType,
+		BindingName:          spec.BindingName,
+		RoleName:             spec.RoleName,
+		RoleKind:             spec.RoleKind,
+		Namespaces:           spec.Namespaces,
+		Users:                make([]User, 0, len(spec.Users)),
+		AggregationLabels:    spec.AggregationLabels,
+		Merge:                spec.Merge,
+		Adopt:                spec.Adopt,
+		NotBefore:            formatTime(spec.NotBefore),
+		ExpiresAt:            formatTime(spec.ExpiresAt),
+		Schedule:             toSchedule(spec.Schedule),
+		Source:               TKEAuthBindingReference(binding),
+
+		SourceCreationTimestamp: binding.CreationTimestamp,
+	}
+
+	for _, user := range spec.Users {
+		tkeAuth.Users = append(tkeAuth.Users, User{
+			Kind:      user.Kind,
+			ValueType: user.Type,
+			Value:     user.Value,
+			Namespace: user.Namespace,
+			Group:     user.Group,
+			NotBefore: formatTime(user.NotBefore),
+			ExpiresAt: formatTime(user.ExpiresAt),
+			Schedule:  toSchedule(user.Schedule),
+		})
+	}
+
+	if len(spec.Rules) > 0 {
+		tkeAuth.Rules = make([]Rule, 0, len(spec.Rules))
+	}
+
+	for _, rule := range spec.Rules {
+		tkeAuth.Rules = append(tkeAuth.Rules, Rule{
+			Verbs:           rule.Verbs,
+			APIGroups:       rule.APIGroups,
+			Resources:       rule.Resources,
+			ResourceNames:   rule.ResourceNames,
+			NonResourceURLs: rule.NonResourceURLs,
+		})
+	}
+
+	// set defaultValue if user.kind or user.valueType is not provided
+	tkeAuth.setDefaults()
+
+	return tkeAuth, nil
+}
+
+// GetTKEAuthBindings returns all deep-copied TKEAuthBinding objects
+func (b *TKEAuthBindings) GetTKEAuthBindings() ([]*v1alpha1.TKEAuthBinding, error) {
+	b.waitUntilCacheSync()
+
+	bindings, err := b.Lister.List(labels.NewSelector())
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*v1alpha1.TKEAuthBinding, 0)
+
+	for _, binding := range bindings {
+		ret = append(ret, binding.DeepCopy())
+	}
+
+	return ret, nil
+}
+
+// UpdateStatus updates status subresource of TKEAuthBinding, resourceVersion of binding is updated to updated one
+func (b *TKEAuthBindings) UpdateStatus(binding *v1alpha1.TKEAuthBinding, status *SyncStatus) error {
+	bindingCopy := binding.DeepCopy()
+	bindingCopy.Status.LastSyncTime = v12.NewTime(status.LastSyncTime)
+	bindingCopy.Status.ObservedGeneration = binding.Generation
+	bindingCopy.Status.LastError = status.LastError
+
+	if !status.Failed {
+		bindingCopy.Status.ResolvedUsers = status.ResolvedUsers
+		bindingCopy.Status.UnresolvedUsers = status.UnresolvedUsers
+		bindingCopy.Status.GeneratedBindings = status.Bindings
+		bindingCopy.Status.Expired = status.Expired
+	}
+
+	updated, err := b.bindingGetter.TKEAuthBindings(binding.Namespace).UpdateStatus(context.TODO(), bindingCopy, v12.UpdateOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "cannot update status of TKEAuthBinding %s/%s", binding.Namespace, binding.Name)
+	}
+	binding.ResourceVersion = updated.ResourceVersion
+
+	return nil
+}
+
+// wait until cache Synced
+func (b *TKEAuthBindings) waitUntilCacheSync() {
+	retryCount := 0
+	for {
+		klog.V(log.VerboseLevel).Infof("Waiting TKEAuthBinding cache to be synced... retryCount: %d", retryCount)
+		if cache.WaitForCacheSync(b.stopCh, b.Synced) {
+			klog.V(log.VerboseLevel).Infoln("TKEAuthBinding cache synced.")
+			break
+		} else {
+			retryCount += 1
+
+			if retryCount > syncRetryCountLimit {
+				panic("Cannot sync TKEAuthBinding.")
+			}
+		}
+	}
+}
+
+func toSchedule(schedule *v1alpha1.TKEAuthBindingSchedule) *Schedule {
+	if schedule == nil {
+		return nil
+	}
+
+	return &Schedule{
+		Cron:     schedule.Cron,
+		Duration: schedule.Duration,
+		Timezone: schedule.Timezone,
+	}
+}
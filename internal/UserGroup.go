@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	v12 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sort"
+)
+
+const (
+	// AnnotationKeyUserGroup marks configMap as user group, value is name of the group. name of configMap is used if empty
+	AnnotationKeyUserGroup = "tke-auth/user-group"
+)
+
+// UserGroup is named list of users, referenced from users of bindings by "- group: <name>"
+type UserGroup struct {
+	Name  string
+	Users []User `yaml:"users"`
+
+	// Source is reference of the configMap which UserGroup is converted from
+	Source v12.ObjectReference `yaml:"-"`
+}
+
+// UserGroups is user groups by "namespace/name" of the group, see userGroupKey
+type UserGroups map[string]*UserGroup
+
+// userGroupKey returns key of user group in UserGroups. group is only visible to sources of same namespace,
+// so that namespace cannot replace or break user groups referenced by other namespaces
+func userGroupKey(namespace string, name string) string {
+	return namespace + "/" + name
+}
+
+// userGroupName returns name of user group defined by configMap
+func userGroupName(cfgMap *v12.ConfigMap) string {
+	if name := cfgMap.Annotations[AnnotationKeyUserGroup]; name != "" {
+		return name
+	}
+
+	return cfgMap.Name
+}
+
+// ToUserGroup returns UserGroup from "users" of configMap. users in group cannot reference another group
+func ToUserGroup(cfgMap *v12.ConfigMap) (*UserGroup, error) {
+	group := &UserGroup{
+		Name:   userGroupName(cfgMap),
+		Source: ConfigMapReference(cfgMap),
+	}
+
+	err := yaml.Unmarshal([]byte(cfgMap.Data[DataKeyUsers]), group)
+	if err != nil {
+		return nil, errors.Wrapf(err, "user group: %s, cannot parse users of configMap %s/%s", group.Name, cfgMap.Namespace, cfgMap.Name)
+	}
+
+	for _, user := range group.Users {
+		if user.IsGroupRef() {
+			return nil, errors.Errorf("user group: %s, cannot reference another group %s.", group.Name, user.Group)
+		}
+	}
+
+	return group, nil
+}
+
+// GetUserGroupConfigMaps returns all deep-copied configMap with "tke-auth/user-group" annotation attached
+func (cfg *TKEAuthConfigMaps) GetUserGroupConfigMaps() ([]*v12.ConfigMap, error) {
+	cfg.waitUntilCacheSync()
+
+	cfgMaps, err := cfg.Lister.List(labels.NewSelector())
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*v12.ConfigMap, 0)
+
+	for _, cfgMap := range cfgMaps {
+		if _, ok := cfgMap.Annotations[AnnotationKeyUserGroup]; ok {
+			ret = append(ret, cfgMap.DeepCopy())
+		}
+	}
+
+	return ret, nil
+}
+
+// ToUserGroups returns user groups of configMaps, and errors of groups which cannot be used, key is "namespace/name" of group.
+// name defined by multiple configMaps in same namespace is an error, since bindings cannot decide which group to use.
+func ToUserGroups(cfgMaps []*v12.ConfigMap) (UserGroups, map[string]error) {
+	groups := make(UserGroups)
+	groupErrs := make(map[string]error)
+
+	for _, cfgMap := range cfgMaps {
+		name := userGroupName(cfgMap)
+		key := userGroupKey(cfgMap.Namespace, name)
+
+		if prev, ok := groups[key]; ok {
+			groupErrs[key] = errors.Errorf("user group: %s, defined by multiple configMaps: %s, %s", name, SourceKey(prev.Source), SourceKey(ConfigMapReference(cfgMap)))
+			continue
+		}
+
+		group, err := ToUserGroup(cfgMap)
+		if err != nil {
+			groupErrs[key] = err
+			continue
+		}
+
+		groups[key] = group
+	}
+
+	for key := range groupErrs {
+		delete(groups, key)
+	}
+
+	return groups, groupErrs
+}
+
+// ExpandUserGroups replaces users referencing group with users of the group in namespace of source, and records referenced groups to UserGroups.
+// returns error if referenced group does not exist or cannot be used.
+func (t *TKEAuth) ExpandUserGroups(groups UserGroups, groupErrs map[string]error) error {
+	users := make([]User, 0, len(t.Users))
+	referenced := make(map[string]bool)
+
+	for _, user := range t.Users {
+		if !user.IsGroupRef() {
+			users = append(users, user)
+			continue
+		}
+
+		referenced[user.Group] = true
+
+		key := userGroupKey(t.Source.Namespace, user.Group)
+		if err, ok := groupErrs[key]; ok {
+			return errors.Wrapf(err, "binding: %s, referenced user group is invalid", t.BindingName)
+		}
+
+		group, ok := groups[key]
+		if !ok {
+			return errors.Errorf("binding: %s, user group %s does not exist in namespace %s.", t.BindingName, user.Group, t.Source.Namespace)
+		}
+
+		users = append(users, group.Users...)
+	}
+
+	t.Users = users
+	t.UserGroups = make([]string, 0, len(referenced))
+	for name := range referenced {
+		t.UserGroups = append(t.UserGroups, name)
+	}
+	sort.Strings(t.UserGroups)
+
+	// users of group follow defaults of binding
+	t.setDefaults()
+
+	return nil
+}
@@ -0,0 +1,308 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"example.com/tke-auth-controller/log"
+	"github.com/pkg/errors"
+	admissionv1 "k8s.io/api/admission/v1"
+	v12 "k8s.io/api/core/v1"
+	v15 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	// WebhookPathValidate is path of validating webhook of configMaps
+	WebhookPathValidate = "/validate"
+	// WebhookPathMutate is path of mutating webhook of configMaps, which normalizes configMap
+	WebhookPathMutate = "/mutate"
+)
+
+// WebhookServer is admission webhook server of tke-auth configMaps, rejects configMap which cannot be synced and normalizes configMap
+type WebhookServer struct {
+	cfg             *TKEAuthConfigMaps
+	namespaceLister listersv1.NamespaceLister
+	policySource    *PolicySource
+
+	// valueTypes is value types of users which can be converted to CommonName
+	valueTypes sets.String
+}
+
+func NewWebhookServer(cfg *TKEAuthConfigMaps, namespaceLister listersv1.NamespaceLister, policySource *PolicySource, valueTypes []string) *WebhookServer {
+	return &WebhookServer{
+		cfg:             cfg,
+		namespaceLister: namespaceLister,
+		policySource:    policySource,
+		valueTypes:      sets.NewString(valueTypes...),
+	}
+}
+
+// Run serves webhook with TLS until stopCh is closed
+func (s *WebhookServer) Run(addr string, certFile string, keyFile string, stopCh <-chan struct{}) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc(WebhookPathValidate, s.serveValidate)
+	mux.HandleFunc(WebhookPathMutate, s.serveMutate)
+
+	server := &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+
+	go func() {
+		<-stopCh
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}()
+
+	klog.Infof("webhook server listening on %s\n", addr)
+	err := server.ListenAndServeTLS(certFile, keyFile)
+	if err != nil && err != http.ErrServerClosed {
+		return errors.Wrap(err, "webhook server stopped")
+	}
+
+	return nil
+}
+
+func (s *WebhookServer) serveValidate(w http.ResponseWriter, r *http.Request) {
+	serveAdmissionReview(w, r, func(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+		cfgMap, err := configMapOfRequest(req)
+		if err != nil {
+			return denied(err)
+		}
+
+		if cfgMap == nil {
+			return allowed()
+		}
+
+		// status annotation and finalizer written by controller should not be denied even if source became invalid,
+		// otherwise status cannot be reported and deleted configMap is stuck in terminating
+		if skip, err := isMetadataOnlyChange(req, cfgMap); err != nil || skip {
+			return allowed()
+		}
+
+		err = s.ValidateConfigMap(cfgMap)
+		if err != nil {
+			klog.V(log.VerboseLevel).Infof("denied configMap %s/%s, err: %s\n", cfgMap.Namespace, cfgMap.Name, err)
+			return denied(err)
+		}
+
+		return allowed()
+	})
+}
+
+func (s *WebhookServer) serveMutate(w http.ResponseWriter, r *http.Request) {
+	serveAdmissionReview(w, r, func(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+		cfgMap, err := configMapOfRequest(req)
+		if err != nil || cfgMap == nil {
+			return allowed()
+		}
+
+		if !v15.HasAnnotation(cfgMap.ObjectMeta, AnnotationKeyTKEAuthConfigMap) && !v15.HasAnnotation(cfgMap.ObjectMeta, AnnotationKeyUserGroup) {
+			return allowed()
+		}
+
+		// invalid configMap is kept as-is, validating webhook rejects it
+		normalized, err := NormalizeConfigMap(cfgMap)
+		if err != nil {
+			klog.V(log.VerboseLevel).Infof("cannot normalize configMap %s/%s, err: %s\n", cfgMap.Namespace, cfgMap.Name, err)
+			return allowed()
+		}
+
+		patch, err := normalizePatch(cfgMap, normalized)
+		if err != nil {
+			klog.Errorf("cannot create patch of configMap %s/%s, err: %s\n", cfgMap.Namespace, cfgMap.Name, err)
+			return allowed()
+		}
+
+		res := allowed()
+		if patch != nil {
+			patchType := admissionv1.PatchTypeJSONPatch
+			res.Patch = patch
+			res.PatchType = &patchType
+		}
+
+		return res
+	})
+}
+
+// normalizePatch returns json patch from configMap to normalized configMap, nil if nothing is changed
+func normalizePatch(cfgMap *v12.ConfigMap, normalized *v12.ConfigMap) ([]byte, error) {
+	type operation struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value string `json:"value"`
+	}
+	ops := make([]operation, 0)
+
+	if cfgMap.Annotations[AnnotationKeyTKEAuthConfigMap] != normalized.Annotations[AnnotationKeyTKEAuthConfigMap] {
+		ops = append(ops, operation{Op: "replace", Path: "/metadata/annotations/" + jsonPointerEscape(AnnotationKeyTKEAuthConfigMap), Value: normalized.Annotations[AnnotationKeyTKEAuthConfigMap]})
+	}
+
+	for _, key := range []string{DataKeyUsers, DataKeyBindings} {
+		if cfgMap.Data[key] != normalized.Data[key] {
+			ops = append(ops, operation{Op: "replace", Path: "/data/" + jsonPointerEscape(key), Value: normalized.Data[key]})
+		}
+	}
+
+	if len(ops) == 0 {
+		return nil, nil
+	}
+
+	return json.Marshal(ops)
+}
+
+// jsonPointerEscape escapes "~" and "/" in key of json patch path
+func jsonPointerEscape(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// ValidateConfigMap returns error if binding or user group configMap cannot be synced.
+// runs same parsing and checks of sync, except existence of referenced role.
+func (s *WebhookServer) ValidateConfigMap(cfgMap *v12.ConfigMap) error {
+	if v15.HasAnnotation(cfgMap.ObjectMeta, AnnotationKeyUserGroup) {
+		group, err := ToUserGroup(cfgMap)
+		if err != nil {
+			return err
+		}
+
+		// users without type follow defaultUserValueType of binding referencing the group
+		tkeAuth := &TKEAuth{BindingName: group.Name, Users: make([]User, 0)}
+		for _, user := range group.Users {
+			if user.ValueType != "" {
+				tkeAuth.Users = append(tkeAuth.Users, user)
+			}
+		}
+		tkeAuth.setDefaults()
+
+		return tkeAuth.CheckValueTypes(s.valueTypes)
+	}
+
+	if !v15.HasAnnotation(cfgMap.ObjectMeta, AnnotationKeyTKEAuthConfigMap) {
+		return nil
+	}
+
+	tkeAuths, errs := ToTKEAuths(cfgMap)
+	if len(errs) > 0 {
+		return utilerrors.NewAggregate(errs)
+	}
+
+	groupCfgMaps, err := s.cfg.GetUserGroupConfigMaps()
+	if err != nil {
+		return err
+	}
+	userGroups, userGroupErrs := ToUserGroups(groupCfgMaps)
+
+	policy, err := s.policySource.Load()
+	if err != nil {
+		return err
+	}
+
+	for _, tkeAuth := range tkeAuths {
+		err := tkeAuth.ExpandUserGroups(userGroups, userGroupErrs)
+		if err == nil {
+			err = tkeAuth.Validate(s.namespaceLister)
+		}
+		if err == nil {
+			err = tkeAuth.CheckValueTypes(s.valueTypes)
+		}
+		if err == nil {
+			err = policy.Check(tkeAuth)
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// configMapOfRequest returns configMap in request, nil if request is not for configMap or deletes configMap
+func configMapOfRequest(req *admissionv1.AdmissionRequest) (*v12.ConfigMap, error) {
+	if req.Kind.Kind != "ConfigMap" || req.Operation == admissionv1.Delete {
+		return nil, nil
+	}
+
+	cfgMap := &v12.ConfigMap{}
+	err := json.Unmarshal(req.Object.Raw, cfgMap)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot decode configMap")
+	}
+
+	// namespace is omitted in object if it's given by request path
+	if cfgMap.Namespace == "" {
+		cfgMap.Namespace = req.Namespace
+	}
+
+	return cfgMap, nil
+}
+
+// isMetadataOnlyChange returns true if configMap is being deleted, or update changes only status annotations and finalizers.
+// adding "tke-auth/binding" annotation to existing configMap is validated, since it is same as creating source.
+func isMetadataOnlyChange(req *admissionv1.AdmissionRequest, cfgMap *v12.ConfigMap) (bool, error) {
+	if cfgMap.DeletionTimestamp != nil {
+		return true, nil
+	}
+
+	if req.Operation != admissionv1.Update {
+		return false, nil
+	}
+
+	oldCfgMap := &v12.ConfigMap{}
+	err := json.Unmarshal(req.OldObject.Raw, oldCfgMap)
+	if err != nil {
+		return false, errors.Wrap(err, "cannot decode old configMap")
+	}
+
+	return reflect.DeepEqual(cfgMap.Data, oldCfgMap.Data) && withoutStatusAnnotations(cfgMap.Annotations) == withoutStatusAnnotations(oldCfgMap.Annotations), nil
+}
+
+// serveAdmissionReview decodes AdmissionReview of request, and writes AdmissionReview with response of review
+func serveAdmissionReview(w http.ResponseWriter, r *http.Request, review func(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse) {
+	admissionReview := &admissionv1.AdmissionReview{}
+	err := json.NewDecoder(r.Body).Decode(admissionReview)
+	if err != nil || admissionReview.Request == nil {
+		klog.Errorf("cannot decode AdmissionReview, err: %s\n", err)
+		http.Error(w, "invalid AdmissionReview", http.StatusBadRequest)
+		return
+	}
+
+	res := review(admissionReview.Request)
+	res.UID = admissionReview.Request.UID
+	admissionReview.Response = res
+	admissionReview.Request = nil
+
+	buf, err := json.Marshal(admissionReview)
+	if err != nil {
+		klog.Errorf("cannot encode AdmissionReview, err: %s\n", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(buf)
+}
+
+func allowed() *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{Allowed: true}
+}
+
+func denied(err error) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{
+		Allowed: false,
+		Result: &v15.Status{
+			Status:  v15.StatusFailure,
+			Message: "tke-auth: " + err.Error(),
+			Reason:  v15.StatusReasonInvalid,
+			Code:    http.StatusUnprocessableEntity,
+		},
+	}
+}
@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"encoding/json"
+	admissionv1 "k8s.io/api/admission/v1"
+	v12 "k8s.io/api/core/v1"
+	v15 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"testing"
+)
+
+func TestIsMetadataOnlyChange(t *testing.T) {
+	configMap := func(annotations map[string]string, finalizers []string, users string) *v12.ConfigMap {
+		return &v12.ConfigMap{
+			ObjectMeta: v15.ObjectMeta{Name: "binding", Namespace: "team-a", Annotations: annotations, Finalizers: finalizers},
+			Data:       map[string]string{DataKeyUsers: users},
+		}
+	}
+	binding := map[string]string{AnnotationKeyTKEAuthConfigMap: ""}
+	withStatus := map[string]string{AnnotationKeyTKEAuthConfigMap: "", annotationPrefixStatus + "last-error": "failed"}
+
+	tests := []struct {
+		name      string
+		operation admissionv1.Operation
+		old, new  *v12.ConfigMap
+		want      bool
+	}{
+		{"create", admissionv1.Create, nil, configMap(binding, nil, "users: []"), false},
+		{"status annotation", admissionv1.Update, configMap(binding, nil, "users: []"), configMap(withStatus, nil, "users: []"), true},
+		{"finalizer", admissionv1.Update, configMap(binding, nil, "users: []"), configMap(binding, []string{FinalizerRevokeBindings}, "users: []"), true},
+		{"data changed", admissionv1.Update, configMap(binding, nil, "users: []"), configMap(binding, nil, "users: [a]"), false},
+		{"binding annotation added to existing configMap", admissionv1.Update, configMap(nil, nil, "users: [a]"), configMap(binding, nil, "users: [a]"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &admissionv1.AdmissionRequest{Operation: tt.operation}
+			if tt.old != nil {
+				raw, err := json.Marshal(tt.old)
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.OldObject = runtime.RawExtension{Raw: raw}
+			}
+
+			got, err := isMetadataOnlyChange(req, tt.new)
+			if err != nil || got != tt.want {
+				t.Errorf("isMetadataOnlyChange() = %t, %v, want %t", got, err, tt.want)
+			}
+		})
+	}
+}
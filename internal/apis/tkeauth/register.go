@@ -0,0 +1,5 @@
+package tkeauth
+
+const (
+	GroupName = "tkeauth.pubg.io"
+)
@@ -0,0 +1,5 @@
+// +k8s:deepcopy-gen=package
+// +groupName=tkeauth.pubg.io
+
+// Package v1alpha1 is the v1alpha1 version of the tke-auth API.
+package v1alpha1
@@ -0,0 +1,127 @@
+package v1alpha1
+
+import (
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// TKEAuthBinding is a typed alternative of ConfigMap with "tke-auth/binding" annotation.
+type TKEAuthBinding struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec TKEAuthBindingSpec `json:"spec"`
+	// +optional
+	Status TKEAuthBindingStatus `json:"status,omitempty"`
+}
+
+// TKEAuthBindingSpec has same fields with users yaml of ConfigMap.
+type TKEAuthBindingSpec struct {
+	// BindingName is name of ClusterRoleBinding object.
+	BindingName string `json:"bindingName"`
+	// RoleName is name of ClusterRole to bind.
+	RoleName string `json:"roleName"`
+	// RoleKind is kind of role to bind, one of ClusterRole, Role. Role requires namespaces.
+	// +optional
+	RoleKind string `json:"roleKind,omitempty"`
+	// DefaultUserValueType is used when user.type is not provided.
+	// +optional
+	DefaultUserValueType string `json:"defaultUserValueType,omitempty"`
+	// Namespaces creates RoleBinding in each namespace instead of ClusterRoleBinding if not empty.
+	// +optional
+	Namespaces []string `json:"namespaces,omitempty"`
+	// +optional
+	Users []TKEAuthBindingUser `json:"users,omitempty"`
+	// Rules creates ClusterRole named RoleName managed by controller if not empty.
+	// +optional
+	Rules []rbacv1.PolicyRule `json:"rules,omitempty"`
+	// Merge allows other sources with same bindingName and roleName to share the binding.
+	// +optional
+	Merge bool `json:"merge,omitempty"`
+	// Adopt decides how existing binding of same name not managed by controller is handled. one of fail, skip, overwrite, merge. default is fail
+	// +optional
+	Adopt string `json:"adopt,omitempty"`
+	// AggregationLabels is labels of managed ClusterRole.
+	// +optional
+	AggregationLabels map[string]string `json:"aggregationLabels,omitempty"`
+	// NotBefore is time when binding starts to be granted.
+	// +optional
+	NotBefore *metav1.Time `json:"notBefore,omitempty"`
+	// ExpiresAt is time when binding is removed.
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+	// Schedule creates binding only while recurring window is open.
+	// +optional
+	Schedule *TKEAuthBindingSchedule `json:"schedule,omitempty"`
+}
+
+type TKEAuthBindingUser struct {
+	// Kind is kind of subject, one of User, Group, ServiceAccount. default is User
+	// +optional
+	Kind string `json:"kind,omitempty"`
+	// Type is value type of user. eg: subAccountId, email
+	// +optional
+	Type string `json:"type,omitempty"`
+	// Value is required unless Group is given
+	// +optional
+	Value string `json:"value,omitempty"`
+	// Namespace is namespace of ServiceAccount
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	// Group is name of user group to expand, which is configMap with "tke-auth/user-group" annotation
+	// +optional
+	Group string `json:"group,omitempty"`
+	// NotBefore is time when user starts to be granted.
+	// +optional
+	NotBefore *metav1.Time `json:"notBefore,omitempty"`
+	// ExpiresAt is time when user is removed from binding.
+	// +optional
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+	// Schedule grants user only while recurring window is open.
+	// +optional
+	Schedule *TKEAuthBindingSchedule `json:"schedule,omitempty"`
+}
+
+// TKEAuthBindingSchedule is recurring window, opens at every Cron and closes after Duration.
+type TKEAuthBindingSchedule struct {
+	// Cron is standard 5 fields cron expression of window start. eg: "0 9 * * 1-5"
+	Cron string `json:"cron"`
+	// Duration is length of window. eg: "8h"
+	Duration string `json:"duration"`
+	// Timezone is IANA timezone of Cron. default is UTC
+	// +optional
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// TKEAuthBindingStatus is result of last sync of TKEAuthBinding.
+type TKEAuthBindingStatus struct {
+	// +optional
+	LastSyncTime metav1.Time `json:"lastSyncTime,omitempty"`
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// +optional
+	ResolvedUsers int `json:"resolvedUsers"`
+	// +optional
+	UnresolvedUsers int `json:"unresolvedUsers"`
+	// GeneratedBindings is names of ClusterRoleBinding or RoleBinding created from TKEAuthBinding.
+	// +optional
+	GeneratedBindings []string `json:"generatedBindings,omitempty"`
+	// +optional
+	LastError string `json:"lastError,omitempty"`
+	// Expired is bindings and users removed by expiresAt, "<bindingName>" or "<bindingName>/<kind>/<value>".
+	// +optional
+	Expired []string `json:"expired,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// TKEAuthBindingList is a list of TKEAuthBinding resources
+type TKEAuthBindingList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+
+	Items []TKEAuthBinding `json:"items"`
+}
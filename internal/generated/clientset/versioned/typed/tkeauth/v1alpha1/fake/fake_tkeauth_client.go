@@ -0,0 +1,24 @@
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	v1alpha1 "example.com/tke-auth-controller/internal/generated/clientset/versioned/typed/tkeauth/v1alpha1"
+	rest "k8s.io/client-go/rest"
+	testing "k8s.io/client-go/testing"
+)
+
+type FakeTkeauthV1alpha1 struct {
+	*testing.Fake
+}
+
+func (c *FakeTkeauthV1alpha1) TKEAuthBindings(namespace string) v1alpha1.TKEAuthBindingInterface {
+	return &FakeTKEAuthBindings{c, namespace}
+}
+
+// RESTClient returns a RESTClient that is used to communicate
+// with API server by this client implementation.
+func (c *FakeTkeauthV1alpha1) RESTClient() rest.Interface {
+	var ret *rest.RESTClient
+	return ret
+}
@@ -0,0 +1,126 @@
+// Code generated by client-gen. DO NOT EDIT.
+
+package fake
+
+import (
+	"context"
+
+	v1alpha1 "example.com/tke-auth-controller/internal/apis/tkeauth/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeTKEAuthBindings implements TKEAuthBindingInterface
+type FakeTKEAuthBindings struct {
+	Fake *FakeTkeauthV1alpha1
+	ns   string
+}
+
+var tkeauthbindingsResource = schema.GroupVersionResource{Group: "tkeauth.pubg.io", Version: "v1alpha1", Resource: "tkeauthbindings"}
+
+var tkeauthbindingsKind = schema.GroupVersionKind{Group: "tkeauth.pubg.io", Version: "v1alpha1", Kind: "TKEAuthBinding"}
+
+// Get takes name of the tKEAuthBinding, and returns the corresponding tKEAuthBinding object, and an error if there is any.
+func (c *FakeTKEAuthBindings) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1alpha1.TKEAuthBinding, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(tkeauthbindingsResource, c.ns, name), &v1alpha1.TKEAuthBinding{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.TKEAuthBinding), err
+}
+
+// List takes label and field selectors, and returns the list of TKEAuthBindings that match those selectors.
+func (c *FakeTKEAuthBindings) List(ctx context.Context, opts v1.ListOptions) (result *v1alpha1.TKEAuthBindingList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(tkeauthbindingsResource, tkeauthbindingsKind, c.ns, opts), &v1alpha1.TKEAuthBindingList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1alpha1.TKEAuthBindingList{ListMeta: obj.(*v1alpha1.TKEAuthBindingList).ListMeta}
+	for _, item := range obj.(*v1alpha1.TKEAuthBindingList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested tKEAuthBindings.
+func (c *FakeTKEAuthBindings) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(tkeauthbindingsResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a tKEAuthBinding and creates it.  Returns the server's representation of the tKEAuthBinding, and an error, if there is any.
+func (c *FakeTKEAuthBindings) Create(ctx context.Context, tKEAuthBinding *v1alpha1.TKEAuthBinding, opts v1.CreateOptions) (result *v1alpha1.TKEAuthBinding, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(tkeauthbindingsResource, c.ns, tKEAuthBinding), &v1alpha1.TKEAuthBinding{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.TKEAuthBinding), err
+}
+
+// Update takes the representation of a tKEAuthBinding and updates it. Returns the server's representation of the tKEAuthBinding, and an error, if there is any.
+func (c *FakeTKEAuthBindings) Update(ctx context.Context, tKEAuthBinding *v1alpha1.TKEAuthBinding, opts v1.UpdateOptions) (result *v1alpha1.TKEAuthBinding, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(tkeauthbindingsResource, c.ns, tKEAuthBinding), &v1alpha1.TKEAuthBinding{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.TKEAuthBinding), err
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeTKEAuthBindings) UpdateStatus(ctx context.Context, tKEAuthBinding *v1alpha1.TKEAuthBinding, opts v1.UpdateOptions) (*v1alpha1.TKEAuthBinding, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(tkeauthbindingsResource, "status", c.ns, tKEAuthBinding), &v1alpha1.TKEAuthBinding{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.TKEAuthBinding), err
+}
+
+// Delete takes name of the tKEAuthBinding and deletes it. Returns an error if one occurs.
+func (c *FakeTKEAuthBindings) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteAction(tkeauthbindingsResource, c.ns, name), &v1alpha1.TKEAuthBinding{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeTKEAuthBindings) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(tkeauthbindingsResource, c.ns, listOpts)
+
+	_, err := c.Fake.Invokes(action, &v1alpha1.TKEAuthBindingList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched tKEAuthBinding.
+func (c *FakeTKEAuthBindings) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.TKEAuthBinding, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(tkeauthbindingsResource, c.ns, name, pt, data, subresources...), &v1alpha1.TKEAuthBinding{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.TKEAuthBinding), err
+}
@@ -0,0 +1,179 @@
+// Code generated by client-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	"context"
+	"time"
+
+	v1alpha1 "example.com/tke-auth-controller/internal/apis/tkeauth/v1alpha1"
+	scheme "example.com/tke-auth-controller/internal/generated/clientset/versioned/scheme"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// TKEAuthBindingsGetter has a method to return a TKEAuthBindingInterface.
+// A group's client should implement this interface.
+type TKEAuthBindingsGetter interface {
+	TKEAuthBindings(namespace string) TKEAuthBindingInterface
+}
+
+// TKEAuthBindingInterface has methods to work with TKEAuthBinding resources.
+type TKEAuthBindingInterface interface {
+	Create(ctx context.Context, tKEAuthBinding *v1alpha1.TKEAuthBinding, opts v1.CreateOptions) (*v1alpha1.TKEAuthBinding, error)
+	Update(ctx context.Context, tKEAuthBinding *v1alpha1.TKEAuthBinding, opts v1.UpdateOptions) (*v1alpha1.TKEAuthBinding, error)
+	UpdateStatus(ctx context.Context, tKEAuthBinding *v1alpha1.TKEAuthBinding, opts v1.UpdateOptions) (*v1alpha1.TKEAuthBinding, error)
+	Delete(ctx context.Context, name string, opts v1.DeleteOptions) error
+	DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error
+	Get(ctx context.Context, name string, opts v1.GetOptions) (*v1alpha1.TKEAuthBinding, error)
+	List(ctx context.Context, opts v1.ListOptions) (*v1alpha1.TKEAuthBindingList, error)
+	Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error)
+	Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.TKEAuthBinding, err error)
+	TKEAuthBindingExpansion
+}
+
+// tKEAuthBindings implements TKEAuthBindingInterface
+type tKEAuthBindings struct {
+	client rest.Interface
+	ns     string
+}
+
+// newTKEAuthBindings returns a TKEAuthBindings
+func newTKEAuthBindings(c *TkeauthV1alpha1Client, namespace string) *tKEAuthBindings {
+	return &tKEAuthBindings{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the tKEAuthBinding, and returns the corresponding tKEAuthBinding object, and an error if there is any.
+func (c *tKEAuthBindings) Get(ctx context.Context, name string, options v1.GetOptions) (result *v1alpha1.TKEAuthBinding, err error) {
+	result = &v1alpha1.TKEAuthBinding{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("tkeauthbindings").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of TKEAuthBindings that match those selectors.
+func (c *tKEAuthBindings) List(ctx context.Context, opts v1.ListOptions) (result *v1alpha1.TKEAuthBindingList, err error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	result = &v1alpha1.TKEAuthBindingList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("tkeauthbindings").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested tKEAuthBindings.
+func (c *tKEAuthBindings) Watch(ctx context.Context, opts v1.ListOptions) (watch.Interface, error) {
+	var timeout time.Duration
+	if opts.TimeoutSeconds != nil {
+		timeout = time.Duration(*opts.TimeoutSeconds) * time.Second
+	}
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("tkeauthbindings").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Watch(ctx)
+}
+
+// Create takes the representation of a tKEAuthBinding and creates it.  Returns the server's representation of the tKEAuthBinding, and an error, if there is any.
+func (c *tKEAuthBindings) Create(ctx context.Context, tKEAuthBinding *v1alpha1.TKEAuthBinding, opts v1.CreateOptions) (result *v1alpha1.TKEAuthBinding, err error) {
+	result = &v1alpha1.TKEAuthBinding{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("tkeauthbindings").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(tKEAuthBinding).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Update takes the representation of a tKEAuthBinding and updates it. Returns the server's representation of the tKEAuthBinding, and an error, if there is any.
+func (c *tKEAuthBindings) Update(ctx context.Context, tKEAuthBinding *v1alpha1.TKEAuthBinding, opts v1.UpdateOptions) (result *v1alpha1.TKEAuthBinding, err error) {
+	result = &v1alpha1.TKEAuthBinding{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("tkeauthbindings").
+		Name(tKEAuthBinding.Name).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(tKEAuthBinding).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *tKEAuthBindings) UpdateStatus(ctx context.Context, tKEAuthBinding *v1alpha1.TKEAuthBinding, opts v1.UpdateOptions) (result *v1alpha1.TKEAuthBinding, err error) {
+	result = &v1alpha1.TKEAuthBinding{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("tkeauthbindings").
+		Name(tKEAuthBinding.Name).
+		SubResource("status").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(tKEAuthBinding).
+		Do(ctx).
+		Into(result)
+	return
+}
+
+// Delete takes name of the tKEAuthBinding and deletes it. Returns an error if one occurs.
+func (c *tKEAuthBindings) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("tkeauthbindings").
+		Name(name).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *tKEAuthBindings) DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error {
+	var timeout time.Duration
+	if listOpts.TimeoutSeconds != nil {
+		timeout = time.Duration(*listOpts.TimeoutSeconds) * time.Second
+	}
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("tkeauthbindings").
+		VersionedParams(&listOpts, scheme.ParameterCodec).
+		Timeout(timeout).
+		Body(&opts).
+		Do(ctx).
+		Error()
+}
+
+// Patch applies the patch and returns the patched tKEAuthBinding.
+func (c *tKEAuthBindings) Patch(ctx context.Context, name string, pt types.PatchType, data []byte, opts v1.PatchOptions, subresources ...string) (result *v1alpha1.TKEAuthBinding, err error) {
+	result = &v1alpha1.TKEAuthBinding{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("tkeauthbindings").
+		Name(name).
+		SubResource(subresources...).
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(data).
+		Do(ctx).
+		Into(result)
+	return
+}
@@ -0,0 +1,74 @@
+// Code generated by informer-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	"context"
+	time "time"
+
+	tkeauthv1alpha1 "example.com/tke-auth-controller/internal/apis/tkeauth/v1alpha1"
+	versioned "example.com/tke-auth-controller/internal/generated/clientset/versioned"
+	internalinterfaces "example.com/tke-auth-controller/internal/generated/informers/externalversions/internalinterfaces"
+	v1alpha1 "example.com/tke-auth-controller/internal/generated/listers/tkeauth/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+	watch "k8s.io/apimachinery/pkg/watch"
+	cache "k8s.io/client-go/tools/cache"
+)
+
+// TKEAuthBindingInformer provides access to a shared informer and lister for
+// TKEAuthBindings.
+type TKEAuthBindingInformer interface {
+	Informer() cache.SharedIndexInformer
+	Lister() v1alpha1.TKEAuthBindingLister
+}
+
+type tKEAuthBindingInformer struct {
+	factory          internalinterfaces.SharedInformerFactory
+	tweakListOptions internalinterfaces.TweakListOptionsFunc
+	namespace        string
+}
+
+// NewTKEAuthBindingInformer constructs a new informer for TKEAuthBinding type.
+// Always prefer using an informer factory to get a shared informer instead of getting an independent
+// one. This reduces memory footprint and number of connections to the server.
+func NewTKEAuthBindingInformer(client versioned.Interface, namespace string, resyncPeriod time.Duration, indexers cache.Indexers) cache.SharedIndexInformer {
+	return NewFilteredTKEAuthBindingInformer(client, namespace, resyncPeriod, indexers, nil)
+}
+
+// NewFilteredTKEAuthBindingInformer constructs a new informer for TKEAuthBinding type.
+// Always prefer using an informer factory to get a shared informer instead of getting an independent
+// one. This reduces memory footprint and number of connections to the server.
+func NewFilteredTKEAuthBindingInformer(client versioned.Interface, namespace string, resyncPeriod time.Duration, indexers cache.Indexers, tweakListOptions internalinterfaces.TweakListOptionsFunc) cache.SharedIndexInformer {
+	return cache.NewSharedIndexInformer(
+		&cache.ListWatch{
+			ListFunc: func(options v1.ListOptions) (runtime.Object, error) {
+				if tweakListOptions != nil {
+					tweakListOptions(&options)
+				}
+				return client.TkeauthV1alpha1().TKEAuthBindings(namespace).List(context.TODO(), options)
+			},
+			WatchFunc: func(options v1.ListOptions) (watch.Interface, error) {
+				if tweakListOptions != nil {
+					tweakListOptions(&options)
+				}
+				return client.TkeauthV1alpha1().TKEAuthBindings(namespace).Watch(context.TODO(), options)
+			},
+		},
+		&tkeauthv1alpha1.TKEAuthBinding{},
+		resyncPeriod,
+		indexers,
+	)
+}
+
+func (f *tKEAuthBindingInformer) defaultInformer(client versioned.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+	return NewFilteredTKEAuthBindingInformer(client, f.namespace, resyncPeriod, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc}, f.tweakListOptions)
+}
+
+func (f *tKEAuthBindingInformer) Informer() cache.SharedIndexInformer {
+	return f.factory.InformerFor(&tkeauthv1alpha1.TKEAuthBinding{}, f.defaultInformer)
+}
+
+func (f *tKEAuthBindingInformer) Lister() v1alpha1.TKEAuthBindingLister {
+	return v1alpha1.NewTKEAuthBindingLister(f.Informer().GetIndexer())
+}
@@ -0,0 +1,11 @@
+// Code generated by lister-gen. DO NOT EDIT.
+
+package v1alpha1
+
+// TKEAuthBindingListerExpansion allows custom methods to be added to
+// TKEAuthBindingLister.
+type TKEAuthBindingListerExpansion interface{}
+
+// TKEAuthBindingNamespaceListerExpansion allows custom methods to be added to
+// TKEAuthBindingNamespaceLister.
+type TKEAuthBindingNamespaceListerExpansion interface{}
@@ -0,0 +1,83 @@
+// Code generated by lister-gen. DO NOT EDIT.
+
+package v1alpha1
+
+import (
+	v1alpha1 "example.com/tke-auth-controller/internal/apis/tkeauth/v1alpha1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// TKEAuthBindingLister helps list TKEAuthBindings.
+// All objects returned here must be treated as read-only.
+type TKEAuthBindingLister interface {
+	// List lists all TKEAuthBindings in the indexer.
+	// Objects returned here must be treated as read-only.
+	List(selector labels.Selector) (ret []*v1alpha1.TKEAuthBinding, err error)
+	// TKEAuthBindings returns an object that can list and get TKEAuthBindings.
+	TKEAuthBindings(namespace string) TKEAuthBindingNamespaceLister
+	TKEAuthBindingListerExpansion
+}
+
+// tKEAuthBindingLister implements the TKEAuthBindingLister interface.
+type tKEAuthBindingLister struct {
+	indexer cache.Indexer
+}
+
+// NewTKEAuthBindingLister returns a new TKEAuthBindingLister.
+func NewTKEAuthBindingLister(indexer cache.Indexer) TKEAuthBindingLister {
+	return &tKEAuthBindingLister{indexer: indexer}
+}
+
+// List lists all TKEAuthBindings in the indexer.
+func (s *tKEAuthBindingLister) List(selector labels.Selector) (ret []*v1alpha1.TKEAuthBinding, err error) {
+	err = cache.ListAll(s.indexer, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1alpha1.TKEAuthBinding))
+	})
+	return ret, err
+}
+
+// TKEAuthBindings returns an object that can list and get TKEAuthBindings.
+func (s *tKEAuthBindingLister) TKEAuthBindings(namespace string) TKEAuthBindingNamespaceLister {
+	return tKEAuthBindingNamespaceLister{indexer: s.indexer, namespace: namespace}
+}
+
+// TKEAuthBindingNamespaceLister helps list and get TKEAuthBindings.
+// All objects returned here must be treated as read-only.
+type TKEAuthBindingNamespaceLister interface {
+	// List lists all TKEAuthBindings in the indexer for a given namespace.
+	// Objects returned here must be treated as read-only.
+	List(selector labels.Selector) (ret []*v1alpha1.TKEAuthBinding, err error)
+	// Get retrieves the TKEAuthBinding from the indexer for a given namespace and name.
+	// Objects returned here must be treated as read-only.
+	Get(name string) (*v1alpha1.TKEAuthBinding, error)
+	TKEAuthBindingNamespaceListerExpansion
+}
+
+// tKEAuthBindingNamespaceLister implements the TKEAuthBindingNamespaceLister
+// interface.
+type tKEAuthBindingNamespaceLister struct {
+	indexer   cache.Indexer
+	namespace string
+}
+
+// List lists all TKEAuthBindings in the indexer for a given namespace.
+func (s tKEAuthBindingNamespaceLister) List(selector labels.Selector) (ret []*v1alpha1.TKEAuthBinding, err error) {
+	err = cache.ListAllByNamespace(s.indexer, s.namespace, selector, func(m interface{}) {
+		ret = append(ret, m.(*v1alpha1.TKEAuthBinding))
+	})
+	return ret, err
+}
+
+// Get retrieves the TKEAuthBinding from the indexer for a given namespace and name.
+func (s tKEAuthBindingNamespaceLister) Get(name string) (*v1alpha1.TKEAuthBinding, error) {
+	obj, exists, err := s.indexer.GetByKey(s.namespace + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.NewNotFound(v1alpha1.Resource("tkeauthbinding"), name)
+	}
+	return obj.(*v1alpha1.TKEAuthBinding), nil
+}
@@ -8,9 +8,12 @@ import (
 	"path/filepath"
 	"runtime"
 	"time"
+	_ "time/tzdata" // timezone of schedule, image may not have tzdata
 
 	"example.com/tke-auth-controller/internal"
 	"example.com/tke-auth-controller/internal/CommonNameResolver"
+	"example.com/tke-auth-controller/internal/generated/clientset/versioned"
+	"example.com/tke-auth-controller/internal/generated/informers/externalversions"
 	"example.com/tke-auth-controller/internal/signals"
 	"github.com/pkg/errors"
 	cam "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/cam/v20190116"
@@ -30,6 +33,19 @@ var (
 	clusterId                   string
 	reSyncInterval   int
 	apiCallPerSecond int
+	workers          int
+	conflictPolicy   string
+	requireNamespacePrefix bool
+	policyFile             string
+	policyConfigMap        string
+	webhookAddr            string
+	webhookCertFile        string
+	webhookKeyFile         string
+	maxDeletions           int
+	maxDeletionPercent     int
+	allowMassDeletion      bool
+	dryRun                 bool
+	planFile               string
 	tkeClient        *v20180525.Client
 	camClient                   *cam.Client
 )
@@ -43,6 +59,19 @@ func init() {
 	flag.StringVar(&clusterId, "clusterId", "", "cluster Id of target.")
 	flag.IntVar(&reSyncInterval, "reSyncInterval", 60*5, "interval (second) to reSync event trigger. does not effect reSync on configMap changes.")
 	flag.IntVar(&apiCallPerSecond, "apiCallPerSecond", 5, "api request limit per second. high value might exceed API Call limit.")
+	flag.IntVar(&workers, "workers", 1, "number of workers processing sync requests. syncs never run concurrently regardless of this value, so 1 is recommended.")
+	flag.StringVar(&conflictPolicy, "conflictPolicy", internal.ConflictPolicyReject, "policy when multiple sources claim same binding. \"reject\": rejects every source, \"firstCreated\": accepts the source created first.")
+	flag.BoolVar(&requireNamespacePrefix, "requireNamespacePrefix", false, "rejects source if name of ClusterRoleBinding or ClusterRole does not start with \"<namespace of source>-\".")
+	flag.StringVar(&policyFile, "policyFile", "", "path of policy file, which decides ClusterRoles allowed to bind for each namespace of source. every ClusterRole is allowed if both policyFile and policyConfigMap are empty.")
+	flag.StringVar(&policyConfigMap, "policyConfigMap", "", "\"namespace/name\" of policy configMap, policy is in \"policy\" key. cannot be used with policyFile.")
+	flag.StringVar(&webhookAddr, "webhookAddr", "", "address of admission webhook server. eg: :8443. webhook is disabled if empty.")
+	flag.StringVar(&webhookCertFile, "webhookCertFile", "", "path of TLS certificate of webhook server.")
+	flag.StringVar(&webhookKeyFile, "webhookKeyFile", "", "path of TLS private key of webhook server.")
+	flag.IntVar(&maxDeletions, "maxDeletions", 10, "refuses sync deleting more bindings and ClusterRoles than this value. 0 means unlimited.")
+	flag.IntVar(&maxDeletionPercent, "maxDeletionPercent", 0, "refuses sync deleting more than this percentage of managed bindings and ClusterRoles. 0 means unlimited.")
+	flag.BoolVar(&allowMassDeletion, "allowMassDeletion", false, "allows sync deleting bindings more than maxDeletions or maxDeletionPercent.")
+	flag.BoolVar(&dryRun, "dryRun", false, "plans changes of ClusterRoleBindings, RoleBindings and ClusterRoles without writing anything, and logs the plan.")
+	flag.StringVar(&planFile, "planFile", "", "path to write plan of last sync as json in dryRun mode. not written if empty.")
 	flag.Parse()
 
 	if clusterName == "" && clusterId == "" {
@@ -121,9 +150,21 @@ func main() {
 		klog.Fatalf("cannot create kubeClient, err: %s", err.Error())
 	}
 
+	tkeAuthClient, err := versioned.NewForConfig(cfg)
+	if err != nil {
+		klog.Fatalf("cannot create tkeAuthClient, err: %s", err.Error())
+	}
+
 	informerFactory := informers.NewSharedInformerFactory(kubeClient, time.Second * time.Duration(reSyncInterval))
-	tkeAuthCfg := internal.NewTKEAuthConfigMaps(informerFactory.Core().V1().ConfigMaps(), informerFactory.Core().V1().ConfigMaps().Lister())
+	tkeAuthInformerFactory := externalversions.NewSharedInformerFactory(tkeAuthClient, time.Second * time.Duration(reSyncInterval))
+	tkeAuthCfg := internal.NewTKEAuthConfigMaps(informerFactory.Core().V1().ConfigMaps(), informerFactory.Core().V1().ConfigMaps().Lister(), kubeClient.CoreV1())
+	// only secrets labeled as binding are cached, other secrets like tokens and TLS keys are never read
+	secretInformerFactory := informers.NewSharedInformerFactoryWithOptions(kubeClient, time.Second * time.Duration(reSyncInterval), informers.WithTweakListOptions(internal.TweakSecretListOptions))
+	tkeAuthSecrets := internal.NewTKEAuthSecrets(secretInformerFactory.Core().V1().Secrets(), secretInformerFactory.Core().V1().Secrets().Lister(), kubeClient.CoreV1())
+	tkeAuthBindings := internal.NewTKEAuthBindings(tkeAuthInformerFactory.Tkeauth().V1alpha1().TKEAuthBindings(), tkeAuthInformerFactory.Tkeauth().V1alpha1().TKEAuthBindings().Lister(), tkeAuthClient.TkeauthV1alpha1())
 	tkeAuthCRB := internal.NewTKEAuthClusterRoleBinding(informerFactory.Rbac().V1().ClusterRoleBindings(), informerFactory.Rbac().V1().ClusterRoleBindings().Lister(), kubeClient.RbacV1().ClusterRoleBindings(), stopCh)
+	tkeAuthRB := internal.NewTKEAuthRoleBinding(informerFactory.Rbac().V1().RoleBindings(), informerFactory.Rbac().V1().RoleBindings().Lister(), kubeClient.RbacV1(), stopCh)
+	tkeAuthRoles := internal.NewTKEAuthRoles(informerFactory.Rbac().V1().ClusterRoles(), informerFactory.Rbac().V1().ClusterRoles().Lister(), informerFactory.Rbac().V1().Roles(), informerFactory.Rbac().V1().Roles().Lister(), kubeClient.RbacV1().ClusterRoles(), stopCh)
 	commonNameResolver := CommonNameResolver.NewCommonNameResolver()
 
 	subAccountIdResolveWorker := CommonNameResolver.NewWorker_SubAccountId(tkeClient, clusterId, apiCallPerSecond)
@@ -131,14 +172,33 @@ func main() {
 	emailResolveWorker := CommonNameResolver.NewWorker_Email(camClient, tkeClient, clusterId, apiCallPerSecond)
 	commonNameResolver.AddWorker(emailResolveWorker)
 
-	controller, err := NewController(kubeClient, tkeAuthCfg, tkeAuthCRB, tkeClient, clusterId, commonNameResolver)
+	policySource, err := internal.NewPolicySource(policyFile, policyConfigMap, informerFactory.Core().V1().ConfigMaps().Lister())
+	if err != nil {
+		klog.Fatalf("cannot create policy source, err: %s", err.Error())
+	}
+	if !policySource.Enabled() {
+		klog.Warningln("policy is not provided, sources of every namespace can bind every ClusterRole.")
+	}
+
+	controller, err := NewController(kubeClient, tkeAuthCfg, tkeAuthBindings, tkeAuthSecrets, tkeAuthCRB, tkeAuthRB, tkeAuthRoles, informerFactory.Core().V1().Namespaces(), tkeClient, clusterId, commonNameResolver, conflictPolicy, requireNamespacePrefix, policySource, internal.DeletionGuard{MaxDeletions: maxDeletions, MaxDeletionPercent: maxDeletionPercent, Disabled: allowMassDeletion}, dryRun, planFile)
 	if err != nil {
 		klog.Fatalf("cannot create controller, err: %s", err.Error())
 	}
 
+	if webhookAddr != "" {
+		webhookServer := internal.NewWebhookServer(tkeAuthCfg, informerFactory.Core().V1().Namespaces().Lister(), policySource, commonNameResolver.ValueTypes())
+		go func() {
+			if err := webhookServer.Run(webhookAddr, webhookCertFile, webhookKeyFile, stopCh); err != nil {
+				klog.Fatalf("Error running webhook server, err: %s", err.Error())
+			}
+		}()
+	}
+
 	informerFactory.Start(stopCh)
+	secretInformerFactory.Start(stopCh)
+	tkeAuthInformerFactory.Start(stopCh)
 
-	if err = controller.Run(stopCh); err != nil {
+	if err = controller.Run(workers, stopCh); err != nil {
 		klog.Fatalf("Error running controller, err: %s", err.Error())
 	}
 }